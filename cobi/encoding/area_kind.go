@@ -0,0 +1,107 @@
+package encoding
+
+import "fmt"
+
+// AreaKind determines which values of an area are stored. Areas, which are flat or only vary in one direction, need
+// fewer values than the bilinear area. The values of an area always contain all four corners, the corners, which are
+// not stored, are copies of the stored ones (s. sourceCorner). Raw areas are an exception, they store their pixels
+// instead of values.
+type AreaKind uint8
+
+const (
+	// BilinearArea stores all four corner values.
+	BilinearArea AreaKind = iota
+	// ConstantArea stores one value for all pixels.
+	ConstantArea
+	// HorizontalArea stores the left and right value, the values only change from left to right.
+	HorizontalArea
+	// VerticalArea stores the upper and bottom value, the values only change from top to bottom.
+	VerticalArea
+	// RawArea stores the pixels of the area (s. EncodedArea.Pixels) and has no values. It's used for areas with many
+	// details, which would otherwise be split into lots of tiny areas.
+	RawArea
+	// QuadraticArea stores the four corner values and five further control values of a quadratic patch
+	// (s. EncodedArea.Midpoints). It covers curved shading, which would need several bilinear areas.
+	QuadraticArea
+)
+
+// numberOfAreaKinds is the number of different area kinds and therefore of symbols needed to store them.
+const numberOfAreaKinds = 6
+
+// Quadratic areas need at least this number of pixels in each direction, so that the control values in the middle of
+// the area affect at least one pixel.
+const minQuadraticAreaSize = 3
+
+// maxQuadraticAreaSize is the largest width and height of quadratic areas. The second order moments of larger areas
+// might not fit into 64 bits, and the second order moments are only available within bands of rows (s. momentBand).
+const maxQuadraticAreaSize = 512
+
+// simplifiedAreaKinds contains the kinds, which the encoder tries instead of a bilinear area, from the fewest to the
+// most stored values.
+var simplifiedAreaKinds = []AreaKind{ConstantArea, HorizontalArea, VerticalArea}
+
+func (k AreaKind) String() string {
+	switch k {
+	case BilinearArea:
+		return "bilinear"
+	case ConstantArea:
+		return "constant"
+	case HorizontalArea:
+		return "horizontal"
+	case VerticalArea:
+		return "vertical"
+	case RawArea:
+		return "raw"
+	case QuadraticArea:
+		return "quadratic"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(k))
+}
+
+// sourceCorner returns the corner, whose value is used for the given corner. Stored corners are their own source.
+func (k AreaKind) sourceCorner(corner int) int {
+	switch k {
+	case ConstantArea:
+		return 0
+	case HorizontalArea:
+		return corner % 2
+	case VerticalArea:
+		return corner - corner%2
+	}
+	return corner
+}
+
+// isStored returns true when the value of the given corner is stored.
+func (k AreaKind) isStored(corner int) bool {
+	return k.sourceCorner(corner) == corner
+}
+
+// matches returns true when the given corner values can be represented by this kind, i.e. when all corners have the
+// values of their source corners.
+func (k AreaKind) matches(values [4]uint8) bool {
+	for i := range values {
+		if values[i] != values[k.sourceCorner(i)] {
+			return false
+		}
+	}
+	return true
+}
+
+// storedSymbols returns the number of symbols stored for the area: the two sizes, the kind and the stored values or,
+// for raw areas, the pixels. This estimates the storage costs of the area without the effects of the entropy coding.
+func storedSymbols(area EncodedArea) int {
+	if area.Kind == RawArea {
+		return 3 + area.W*area.H
+	}
+
+	symbols := 3
+	for i := 0; i < 4; i++ {
+		if area.Kind.isStored(i) {
+			symbols++
+		}
+	}
+	if area.Kind == QuadraticArea {
+		symbols += len(area.Midpoints)
+	}
+	return symbols
+}
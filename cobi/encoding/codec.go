@@ -0,0 +1,67 @@
+package encoding
+
+import (
+	"cobi/image"
+	goimage "image"
+	"image/color"
+	"io"
+)
+
+// Register the cobi format, so that image.Decode and image.DecodeConfig of the standard library can handle cobi data
+// when this package is imported.
+func init() {
+	goimage.RegisterFormat("cobi", Magic, Decode, DecodeConfig)
+}
+
+// Encode writes the image to w in the cobi format. Images other than cobi images are converted first, which only
+// works for images with at most 8 bits per channel. The default options are used when the given options are nil.
+func Encode(w io.Writer, img goimage.Image, options *Options) error {
+	cobiImage, err := toCobiImage(img)
+	if err != nil {
+		return err
+	}
+
+	encodedImage, err := EncodeImage(*cobiImage, options)
+	if err != nil {
+		return err
+	}
+
+	return WriteImage(w, encodedImage)
+}
+
+// Decode reads a cobi image from r. The returned image is of type *image.Image of the cobi/image package.
+func Decode(r io.Reader) (goimage.Image, error) {
+	encodedImage, err := ReadImage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := DecodeImage(encodedImage)
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// DecodeConfig returns the color model and dimensions of a cobi image without decoding the entire image. Only the
+// header is read from r.
+func DecodeConfig(r io.Reader) (goimage.Config, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return goimage.Config{}, err
+	}
+
+	return goimage.Config{
+		ColorModel: color.RGBAModel,
+		Width:      h.width,
+		Height:     h.height,
+	}, nil
+}
+
+func toCobiImage(img goimage.Image) (*image.Image, error) {
+	if cobiImage, ok := img.(*image.Image); ok {
+		return cobiImage, nil
+	}
+	return image.FromGoImage(img)
+}
@@ -0,0 +1,106 @@
+package encoding
+
+import (
+	"bytes"
+	"cobi/image"
+	"cobi/util"
+	goimage "image"
+	"image/color"
+	"testing"
+)
+
+func Test_encodeAndDecode(t *testing.T) {
+	img := newTestImage(40, 30)
+	expectedAreas, err := EncodeAreas(*img, nil)
+	util.AssertNil(t, err)
+	expectedImage, err := DecodeAreas(expectedAreas)
+	util.AssertNil(t, err)
+
+	buffer := &bytes.Buffer{}
+	err = Encode(buffer, img, nil)
+	util.AssertNil(t, err)
+
+	decodedImage, err := Decode(buffer)
+
+	util.AssertNil(t, err)
+	util.AssertEqual(t, 0, buffer.Len())
+	cobiImage := decodedImage.(*image.Image)
+	util.AssertEqual(t, img.Width, cobiImage.Width)
+	util.AssertEqual(t, img.Height, cobiImage.Height)
+	util.AssertArrayEqual(t, expectedImage.R, cobiImage.R)
+	util.AssertArrayEqual(t, expectedImage.G, cobiImage.G)
+	util.AssertArrayEqual(t, expectedImage.B, cobiImage.B)
+	util.AssertArrayEqual(t, expectedImage.A, cobiImage.A)
+}
+
+func Test_encode_options(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	buffer := &bytes.Buffer{}
+	err := Encode(buffer, img, &Options{Quality: 0, Lossless: true})
+	util.AssertNil(t, err)
+	decodedImage, err := Decode(buffer)
+	util.AssertNil(t, err)
+
+	// The lossless mode of the options restores the original image despite the low quality
+	cobiImage := decodedImage.(*image.Image)
+	util.AssertArrayEqual(t, img.R, cobiImage.R)
+	util.AssertArrayEqual(t, img.G, cobiImage.G)
+	util.AssertArrayEqual(t, img.B, cobiImage.B)
+	util.AssertArrayEqual(t, img.A, cobiImage.A)
+
+	err = Encode(&bytes.Buffer{}, img, &Options{Quality: 101})
+	util.AssertError(t, "Quality must be between 0 and 100 but was 101", err)
+}
+
+func Test_encodeAndDecode_emptyImage(t *testing.T) {
+	for _, size := range [][2]int{{0, 5}, {5, 0}, {0, 0}} {
+		img := newTestImage(size[0], size[1])
+
+		for _, options := range []*Options{nil, {Quality: DefaultQuality, Lossless: true}, {Quality: DefaultQuality, Mesh: true}} {
+			buffer := &bytes.Buffer{}
+			err := Encode(buffer, img, options)
+			util.AssertNil(t, err)
+
+			decodedImage, err := Decode(buffer)
+			util.AssertNil(t, err)
+			cobiImage := decodedImage.(*image.Image)
+			util.AssertEqual(t, img.Width, cobiImage.Width)
+			util.AssertEqual(t, img.Height, cobiImage.Height)
+			util.AssertArrayEqual(t, img.R, cobiImage.R)
+			util.AssertArrayEqual(t, img.A, cobiImage.A)
+		}
+	}
+
+	// Only empty images may have no areas
+	_, err := DecodeImage(&EncodedImage{Width: 5, Height: 3})
+	util.AssertError(t, "Areas cover 0x0 pixels but the image has a size of 5x3", err)
+}
+
+func Test_decode_invalidData(t *testing.T) {
+	img, err := Decode(bytes.NewReader([]byte("no cobi data")))
+
+	util.AssertNotNil(t, err)
+	util.AssertTrue(t, img == nil)
+}
+
+func Test_registeredFormat(t *testing.T) {
+	img := newTestImage(40, 30)
+	buffer := &bytes.Buffer{}
+	err := Encode(buffer, img, nil)
+	util.AssertNil(t, err)
+	data := buffer.Bytes()
+
+	config, format, err := goimage.DecodeConfig(bytes.NewReader(data))
+	util.AssertNil(t, err)
+	util.AssertEqual(t, "cobi", format)
+	util.AssertEqual(t, 40, config.Width)
+	util.AssertEqual(t, 30, config.Height)
+	util.AssertEqual(t, color.RGBAModel, config.ColorModel)
+
+	decodedImage, format, err := goimage.Decode(bytes.NewReader(data))
+	util.AssertNil(t, err)
+	util.AssertEqual(t, "cobi", format)
+	util.AssertEqual(t, goimage.Rect(0, 0, 40, 30), decodedImage.Bounds())
+	util.AssertEqual(t, color.Color(color.RGBA{}), decodedImage.At(40, 0))
+}
@@ -0,0 +1,185 @@
+package encoding
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"sort"
+)
+
+// AreaCostFunc determines how bad the interpolation of an area approximates the original values of a channel. The
+// encoder only accepts areas with a cost below the threshold given by the quality. The costs of different functions
+// have different scales, so each function maps the quality to its own threshold. The mappings are calibrated on
+// photographs, so that the same quality results in a similar error of the decoded image for all functions.
+type AreaCostFunc interface {
+	// Cost returns the cost of the interpolated values of an area. The area starts at (x, y) of the original channel
+	// and has the size of the interpolated values.
+	Cost(channel [][]uint8, x, y int, interpolated [][]uint8) float64
+	// Threshold returns the cost below which an area is accepted at the given quality from 0 to 100.
+	Threshold(quality int) float64
+}
+
+// SquaredErrorCostFunc is an AreaCostFunc, whose cost only depends on the size of an area and the sum of the squared
+// differences between original and interpolated values. The encoder determines this sum in constant time from
+// summed-area tables (s. integralImage) instead of interpolating each candidate area, which makes these cost
+// functions much faster than others.
+type SquaredErrorCostFunc interface {
+	AreaCostFunc
+	// SquaredErrorCost returns the same cost as Cost for an area of the given size and sum of squared errors.
+	SquaredErrorCost(width, height int, squaredError float64) float64
+}
+
+// CostFuncs contains all available cost functions by their name.
+var CostFuncs = map[string]AreaCostFunc{
+	"default":    DefaultCost{},
+	"max":        MaxAbsoluteErrorCost{},
+	"mse":        MeanSquaredErrorCost{},
+	"perceptual": PerceptualCost{},
+}
+
+// CostFuncNames returns the sorted names of all available cost functions.
+func CostFuncNames() []string {
+	var names []string
+	for name := range CostFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetCostFunc returns the cost function with the given name (s. CostFuncs).
+func GetCostFunc(name string) (AreaCostFunc, error) {
+	costFunc, ok := CostFuncs[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unknown cost function %s, available are: %v", name, CostFuncNames()))
+	}
+	return costFunc, nil
+}
+
+// DefaultCost is the squared root mean square error with penalties for large and for non-squared areas. Originally,
+// the mean absolute error was used instead of the root mean square error, which needs the interpolated values of each
+// candidate area. Both are equal for constant errors, and the root mean square error weights outliers higher.
+type DefaultCost struct{}
+
+func (c DefaultCost) Cost(channel [][]uint8, x, y int, interpolated [][]uint8) float64 {
+	return c.SquaredErrorCost(len(interpolated), len(interpolated[0]), squaredErrorSum(channel, x, y, interpolated))
+}
+
+func (c DefaultCost) SquaredErrorCost(width, height int, squaredError float64) float64 {
+	numberPixels := float64(width) * float64(height)
+
+	max := math.Max(float64(width), float64(height))
+	min := math.Min(float64(width), float64(height))
+
+	// Penalty for large areas as they would otherwise create large artifacts
+	sizeFactor := (max * min) / (255.0 * max)
+
+	// Penalty for non-squared areas (i.e. rectangles with a very long and a very short edge)
+	squareFactor := max / min
+
+	return squaredError / numberPixels * math.Pow(squareFactor, 2) * math.Pow(sizeFactor, 2)
+}
+
+func (c DefaultCost) Threshold(quality int) float64 {
+	return qualityThreshold(quality)
+}
+
+// MaxAbsoluteErrorCost is the squared maximum absolute error of all pixels. With this cost function, an area is
+// rejected as soon as a single pixel deviates too much.
+type MaxAbsoluteErrorCost struct{}
+
+func (c MaxAbsoluteErrorCost) Cost(channel [][]uint8, x, y int, interpolated [][]uint8) float64 {
+	maxDifference := 0.0
+	for ax := range interpolated {
+		for ay := range interpolated[ax] {
+			maxDifference = math.Max(maxDifference, math.Abs(float64(channel[x+ax][y+ay])-float64(interpolated[ax][ay])))
+		}
+	}
+
+	return math.Pow(maxDifference/255.0, 2)
+}
+
+// Threshold allows a maximum difference of about 11 at quality 0, 3.6 at quality 50 and 1.1 at quality 100.
+func (c MaxAbsoluteErrorCost) Threshold(quality int) float64 {
+	return exponentialThreshold(quality, 0.002, 50)
+}
+
+// MeanSquaredErrorCost is the mean squared error of all pixels.
+type MeanSquaredErrorCost struct{}
+
+func (c MeanSquaredErrorCost) Cost(channel [][]uint8, x, y int, interpolated [][]uint8) float64 {
+	return c.SquaredErrorCost(len(interpolated), len(interpolated[0]), squaredErrorSum(channel, x, y, interpolated))
+}
+
+func (c MeanSquaredErrorCost) SquaredErrorCost(width, height int, squaredError float64) float64 {
+	return squaredError / (float64(width) * float64(height)) / (255.0 * 255.0)
+}
+
+// Threshold allows a mean squared error of about 12 at quality 0, 1.8 at quality 50 and 0.27 at quality 100. Unlike the
+// DefaultCost, the error of large areas isn't penalized, so the threshold is lower and decreases slower with the
+// quality.
+func (c MeanSquaredErrorCost) Threshold(quality int) float64 {
+	return meanSquaredErrorThreshold(quality)
+}
+
+// PerceptualCost is the mean squared error weighted by the visibility of errors. Errors in flat or smoothly shaded
+// regions are more visible than errors in textured regions, where they are masked by the texture. Therefore, the error
+// is divided by a factor growing with the activity of the original values, which is the mean absolute difference of
+// neighboring pixels.
+type PerceptualCost struct{}
+
+// perceptualMaskingActivity is the activity of the original values at which the error is weighted by one half.
+const perceptualMaskingActivity = 8.0
+
+func (c PerceptualCost) Cost(channel [][]uint8, x, y int, interpolated [][]uint8) float64 {
+	width := len(interpolated)
+	height := len(interpolated[0])
+
+	summedDifferences := 0.0
+	numberOfDifferences := 0
+	for ax := 0; ax < width; ax++ {
+		for ay := 0; ay < height; ay++ {
+			if ax+1 < width {
+				summedDifferences += math.Abs(float64(channel[x+ax+1][y+ay]) - float64(channel[x+ax][y+ay]))
+				numberOfDifferences++
+			}
+			if ay+1 < height {
+				summedDifferences += math.Abs(float64(channel[x+ax][y+ay+1]) - float64(channel[x+ax][y+ay]))
+				numberOfDifferences++
+			}
+		}
+	}
+
+	activity := 0.0
+	if numberOfDifferences > 0 {
+		activity = summedDifferences / float64(numberOfDifferences)
+	}
+
+	maskingFactor := 1 + math.Pow(activity/perceptualMaskingActivity, 2)
+	return meanSquaredError(channel, x, y, interpolated) / maskingFactor / (255.0 * 255.0)
+}
+
+// Threshold is the one of the MeanSquaredErrorCost, since both costs are equal in flat regions.
+func (c PerceptualCost) Threshold(quality int) float64 {
+	return meanSquaredErrorThreshold(quality)
+}
+
+func meanSquaredErrorThreshold(quality int) float64 {
+	return exponentialThreshold(quality, 0.00019, 60)
+}
+
+func meanSquaredError(channel [][]uint8, x, y int, interpolated [][]uint8) float64 {
+	return squaredErrorSum(channel, x, y, interpolated) / float64(len(interpolated)*len(interpolated[0]))
+}
+
+func squaredErrorSum(channel [][]uint8, x, y int, interpolated [][]uint8) float64 {
+	summedSquaredDifferences := 0.0
+	for ax := range interpolated {
+		for ay := range interpolated[ax] {
+			diff := float64(channel[x+ax][y+ay]) - float64(interpolated[ax][ay])
+			summedSquaredDifferences += diff * diff
+		}
+	}
+
+	return summedSquaredDifferences
+}
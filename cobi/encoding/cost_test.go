@@ -0,0 +1,128 @@
+package encoding
+
+import (
+	"cobi/image"
+	"cobi/metrics"
+	"cobi/util"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func Test_costFuncs(t *testing.T) {
+	// 10 10 10 10
+	// 10 10 10 10
+	// 10 10 10 50
+	channel := util.TransposeArray([][]uint8{
+		{10, 10, 10, 10},
+		{10, 10, 10, 10},
+		{10, 10, 10, 50},
+	})
+	interpolated := util.TransposeArray([][]uint8{
+		{10, 10, 10, 10},
+		{10, 10, 10, 10},
+		{10, 10, 10, 10},
+	})
+
+	util.AssertAlmostEqual(t, 1600.0/12.0*math.Pow(4.0/255.0, 2), DefaultCost{}.Cost(channel, 0, 0, interpolated), 1e-12)
+	util.AssertAlmostEqual(t, math.Pow(40.0/255.0, 2), MaxAbsoluteErrorCost{}.Cost(channel, 0, 0, interpolated), 1e-12)
+	util.AssertAlmostEqual(t, 1600.0/12.0/(255.0*255.0), MeanSquaredErrorCost{}.Cost(channel, 0, 0, interpolated), 1e-12)
+	util.AssertTrue(t, PerceptualCost{}.Cost(channel, 0, 0, interpolated) < MeanSquaredErrorCost{}.Cost(channel, 0, 0, interpolated))
+}
+
+func Test_costFuncs_perfectInterpolation(t *testing.T) {
+	channel := util.TransposeArray([][]uint8{
+		{0, 1, 2, 3},
+		{0, 1, 2, 3},
+	})
+	interpolated := util.TransposeArray([][]uint8{
+		{2, 3},
+		{2, 3},
+	})
+
+	for name, costFunc := range CostFuncs {
+		if costFunc.Cost(channel, 2, 0, interpolated) != 0 {
+			t.Errorf("Expected cost of %s to be 0", name)
+		}
+	}
+}
+
+// countingCost counts the calls of Cost, which the encoder must not need for a SquaredErrorCostFunc.
+type countingCost struct {
+	DefaultCost
+	calls *int
+}
+
+func (c countingCost) Cost(channel [][]uint8, x, y int, interpolated [][]uint8) float64 {
+	*c.calls++
+	return c.DefaultCost.Cost(channel, x, y, interpolated)
+}
+
+func Test_defaultCost_squaredErrorCost(t *testing.T) {
+	_, isSquaredErrorCostFunc := CostFuncs["default"].(SquaredErrorCostFunc)
+	util.AssertTrue(t, isSquaredErrorCostFunc)
+
+	// The encoder determines the costs from the summed-area tables without interpolating the areas
+	calls := 0
+	_, err := EncodeAreas(*newTestImage(40, 30), &Options{Quality: DefaultQuality, CostFunc: countingCost{calls: &calls}})
+	util.AssertNil(t, err)
+	util.AssertEqual(t, 0, calls)
+}
+
+func Test_costFuncs_threshold(t *testing.T) {
+	img := newSmoothTestImage(96, 64)
+
+	meanPSNR := func(costFunc AreaCostFunc) float64 {
+		encodedImage, err := EncodeImage(*img, &Options{Quality: DefaultQuality, CostFunc: costFunc})
+		util.AssertNil(t, err)
+		decodedImage, err := DecodeImage(encodedImage)
+		util.AssertNil(t, err)
+		m, err := metrics.Compare(img, decodedImage)
+		util.AssertNil(t, err)
+		return (m.R.PSNR + m.G.PSNR + m.B.PSNR) / 3
+	}
+
+	// The thresholds are calibrated, so that all cost functions result in a similar error at the same quality
+	defaultPSNR := meanPSNR(DefaultCost{})
+	for name, costFunc := range CostFuncs {
+		psnr := meanPSNR(costFunc)
+		if math.Abs(psnr-defaultPSNR) > 3 {
+			t.Errorf("Expected PSNR of %s to be close to %.2fdB of the default cost but was %.2fdB", name, defaultPSNR, psnr)
+		}
+	}
+}
+
+// newSmoothTestImage creates an image with smooth shading, an edge and slight noise like photographs.
+func newSmoothTestImage(width, height int) *image.Image {
+	random := rand.New(rand.NewSource(42))
+	img := image.New(width, height)
+
+	for x := 0; x < width; x++ {
+		img.R[x] = make([]uint8, height)
+		img.G[x] = make([]uint8, height)
+		img.B[x] = make([]uint8, height)
+		img.A[x] = make([]uint8, height)
+
+		for y := 0; y < height; y++ {
+			shading := 100 + 60*math.Sin(float64(x)/15)*math.Cos(float64(y)/11)
+			if x > width/3 {
+				shading += 50
+			}
+			img.R[x][y] = uint8(shading + random.NormFloat64())
+			img.G[x][y] = uint8(shading/2 + random.NormFloat64())
+			img.B[x][y] = uint8(255 - shading + random.NormFloat64())
+			img.A[x][y] = 255
+		}
+	}
+
+	return img
+}
+
+func Test_getCostFunc(t *testing.T) {
+	costFunc, err := GetCostFunc("mse")
+	util.AssertNil(t, err)
+	util.AssertEqual(t, AreaCostFunc(MeanSquaredErrorCost{}), costFunc)
+
+	_, err = GetCostFunc("foo")
+	util.AssertError(t, "Unknown cost function foo, available are: [default max mse perceptual]", err)
+}
@@ -0,0 +1,243 @@
+package encoding
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"math/bits"
+)
+
+// coverageMap keeps track of which pixels of a channel are already covered by encoded areas. It is used by the
+// encoder to find the position of the next area and by the decoder to replay this walk, so that area positions don't
+// need to be stored.
+//
+// The covered pixels are stored as bitset with one bit per pixel. Each row starts at a new word, so that runs of
+// covered or uncovered pixels within a row are found word by word. Additionally, the first uncovered row of each column
+// is kept in a skyline, which determines the smallest uncovered pixel in logarithmic time.
+type coverageMap struct {
+	coveredPixel       []uint64
+	wordsPerRow        int
+	skyline            *skyline
+	minUncoveredPixelX int
+	minUncoveredPixelY int
+	width              int
+	height             int
+}
+
+func newCoverageMap(width, height int) *coverageMap {
+	wordsPerRow := (width + 63) / 64
+
+	c := &coverageMap{
+		coveredPixel: make([]uint64, wordsPerRow*height),
+		wordsPerRow:  wordsPerRow,
+		skyline:      newSkyline(width),
+		width:        width,
+		height:       height,
+	}
+	c.minUncoveredPixelX, c.minUncoveredPixelY = c.findMinUncoveredPixel()
+
+	return c
+}
+
+func (c *coverageMap) isCovered(x, y int) bool {
+	return c.coveredPixel[y*c.wordsPerRow+x/64]&(1<<uint(x%64)) != 0
+}
+
+// freeRunWidth returns the number of consecutive uncovered pixels in row y starting at column x.
+func (c *coverageMap) freeRunWidth(x, y int) int {
+	row := c.coveredPixel[y*c.wordsPerRow : (y+1)*c.wordsPerRow]
+	for word := x / 64; word < len(row); word++ {
+		covered := row[word]
+		if word == x/64 {
+			// Ignore the pixels left of x
+			covered &= ^uint64(0) << uint(x%64)
+		}
+		if covered != 0 {
+			return word*64 + bits.TrailingZeros64(covered) - x
+		}
+	}
+	return c.width - x
+}
+
+func (c *coverageMap) add(encodedArea EncodedArea) {
+	for y := encodedArea.Y; y < encodedArea.Y+encodedArea.H; y++ {
+		row := c.coveredPixel[y*c.wordsPerRow : (y+1)*c.wordsPerRow]
+		forEachWord(encodedArea.X, encodedArea.X+encodedArea.W, func(word int, mask uint64) {
+			row[word] |= mask
+		})
+	}
+
+	for x := encodedArea.X; x < encodedArea.X+encodedArea.W; x++ {
+		columnHeight := c.skyline.height(x)
+		if columnHeight < encodedArea.Y || columnHeight >= encodedArea.Y+encodedArea.H {
+			continue
+		}
+
+		// The first uncovered pixel of the column is now covered, so look for the next one below the area
+		columnHeight = encodedArea.Y + encodedArea.H
+		for columnHeight < c.height && c.isCovered(x, columnHeight) {
+			columnHeight++
+		}
+		c.skyline.set(x, columnHeight)
+	}
+
+	c.minUncoveredPixelX, c.minUncoveredPixelY = c.findMinUncoveredPixel()
+}
+
+// findMinUncoveredPixel determines the smallest pixel that is not covered by any area, i.e. the first uncovered pixel
+// of the first row with uncovered pixels. This is the leftmost column of the skyline with the smallest height.
+func (c *coverageMap) findMinUncoveredPixel() (int, int) {
+	x, y := c.skyline.min()
+	if y >= c.height {
+		// No pixel has been found that's not covered
+		return -1, -1
+	}
+	return x, y
+}
+
+// restoreAreaPositions sets the X and Y coordinates of the given areas by replaying the walk of the encoder over the
+// coverage map. Each area is placed at the smallest pixel not yet covered by the previous areas. An error is returned
+// when the areas do not exactly cover an image of the given size.
+func restoreAreaPositions(areas []EncodedArea, width, height int) error {
+	coverage := newCoverageMap(width, height)
+
+	for i := range areas {
+		err := coverage.place(&areas[i])
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Area %d is invalid", i))
+		}
+	}
+
+	return coverage.ensureComplete()
+}
+
+// place sets the position of the area to the smallest uncovered pixel and adds the area to the coverage map.
+func (c *coverageMap) place(area *EncodedArea) error {
+	if c.minUncoveredPixelX == -1 || c.minUncoveredPixelY == -1 {
+		return errors.New("Area does not fit into the image, all pixels are already covered")
+	}
+	area.X, area.Y = c.minUncoveredPixelX, c.minUncoveredPixelY
+
+	err := c.ensureFree(*area)
+	if err != nil {
+		return err
+	}
+
+	c.add(*area)
+	return nil
+}
+
+// ensureComplete returns an error when not all pixels are covered.
+func (c *coverageMap) ensureComplete() error {
+	if c.minUncoveredPixelX != -1 || c.minUncoveredPixelY != -1 {
+		return errors.New(fmt.Sprintf("Areas do not cover the whole image, pixel (%d, %d) is uncovered", c.minUncoveredPixelX, c.minUncoveredPixelY))
+	}
+	return nil
+}
+
+// ensureFree returns an error when the given area exceeds the image or overlaps already covered pixels.
+func (c *coverageMap) ensureFree(area EncodedArea) error {
+	if area.W == 0 || area.H == 0 || area.X+area.W > c.width || area.Y+area.H > c.height {
+		return errors.New(fmt.Sprintf("Area at (%d, %d) with size %dx%d exceeds the image size %dx%d", area.X, area.Y, area.W, area.H, c.width, c.height))
+	}
+
+	for y := area.Y; y < area.Y+area.H; y++ {
+		row := c.coveredPixel[y*c.wordsPerRow : (y+1)*c.wordsPerRow]
+		coveredX := -1
+		forEachWord(area.X, area.X+area.W, func(word int, mask uint64) {
+			if coveredX == -1 && row[word]&mask != 0 {
+				coveredX = word*64 + bits.TrailingZeros64(row[word]&mask)
+			}
+		})
+		if coveredX != -1 {
+			return errors.New(fmt.Sprintf("Area at (%d, %d) with size %dx%d overlaps covered pixel (%d, %d)", area.X, area.Y, area.W, area.H, coveredX, y))
+		}
+	}
+
+	return nil
+}
+
+// forEachWord calls the function for each word of a bitset row containing the bits from (inclusive) to (exclusive).
+// The mask contains the bits of the word within this range.
+func forEachWord(from, to int, f func(word int, mask uint64)) {
+	for from < to {
+		word := from / 64
+		wordEnd := (word + 1) * 64
+		if wordEnd > to {
+			wordEnd = to
+		}
+
+		mask := ^uint64(0) << uint(from%64)
+		if wordEnd%64 != 0 {
+			mask &= ^uint64(0) >> uint(64-wordEnd%64)
+		}
+		f(word, mask)
+
+		from = wordEnd
+	}
+}
+
+// skyline contains the height of each column, which is its first uncovered row. It's a segment tree determining the
+// leftmost column with the smallest height and updating a column in logarithmic time.
+type skyline struct {
+	// leaves is the number of leaves of the tree, which is the width rounded up to a power of two.
+	leaves int
+	// minHeights contains the tree with the root at index 1 and the children of node i at 2i and 2i+1. The leaves
+	// beyond the width have the maximum height, so they are never the smallest one.
+	minHeights []int
+}
+
+func newSkyline(width int) *skyline {
+	leaves := 1
+	for leaves < width {
+		leaves *= 2
+	}
+
+	s := &skyline{
+		leaves:     leaves,
+		minHeights: make([]int, 2*leaves),
+	}
+	for x := width; x < leaves; x++ {
+		s.minHeights[leaves+x] = math.MaxInt
+	}
+	for i := leaves - 1; i > 0; i-- {
+		s.updateNode(i)
+	}
+
+	return s
+}
+
+func (s *skyline) height(x int) int {
+	return s.minHeights[s.leaves+x]
+}
+
+func (s *skyline) set(x, height int) {
+	i := s.leaves + x
+	s.minHeights[i] = height
+	for i /= 2; i > 0; i /= 2 {
+		s.updateNode(i)
+	}
+}
+
+// updateNode sets the height of the inner node to the smaller height of its children.
+func (s *skyline) updateNode(i int) {
+	left, right := s.minHeights[2*i], s.minHeights[2*i+1]
+	if left <= right {
+		s.minHeights[i] = left
+	} else {
+		s.minHeights[i] = right
+	}
+}
+
+// min returns the leftmost column with the smallest height and this height.
+func (s *skyline) min() (int, int) {
+	i := 1
+	for i < s.leaves {
+		if s.minHeights[2*i] == s.minHeights[i] {
+			i = 2 * i
+		} else {
+			i = 2*i + 1
+		}
+	}
+	return i - s.leaves, s.minHeights[1]
+}
@@ -0,0 +1,113 @@
+package encoding
+
+import (
+	"cobi/image"
+	"cobi/util"
+	"math/rand"
+	"testing"
+)
+
+func Test_restoreAreaPositions(t *testing.T) {
+	img := newTestImage(40, 30)
+	encodedAreas, err := EncodeAreas(*img, nil)
+	util.AssertNil(t, err)
+
+	for _, areas := range encodedAreas {
+		strippedAreas := make([]EncodedArea, len(areas))
+		for i, area := range areas {
+			strippedAreas[i] = EncodedArea{W: area.W, H: area.H, Values: area.Values, Kind: area.Kind, Pixels: area.Pixels, Midpoints: area.Midpoints}
+		}
+
+		err = restoreAreaPositions(strippedAreas, img.Width, img.Height)
+
+		util.AssertNil(t, err)
+		for i := range areas {
+			util.AssertDeepEqual(t, areas[i], strippedAreas[i])
+		}
+	}
+}
+
+func Test_restoreAreaPositions_areasNotCoveringImage(t *testing.T) {
+	areas := []EncodedArea{
+		{W: 5, H: 5},
+		{W: 2, H: 5},
+	}
+
+	err := restoreAreaPositions(areas, 8, 5)
+
+	util.AssertError(t, "Areas do not cover the whole image, pixel (7, 0) is uncovered", err)
+}
+
+func Test_restoreAreaPositions_areaExceedingImage(t *testing.T) {
+	areas := []EncodedArea{
+		{W: 5, H: 5},
+		{W: 4, H: 5},
+	}
+
+	err := restoreAreaPositions(areas, 8, 5)
+
+	util.AssertError(t, "Area 1 is invalid: Area at (5, 0) with size 4x5 exceeds the image size 8x5", err)
+}
+
+func Test_coverageMap_freeRunWidthAndMinUncoveredPixel(t *testing.T) {
+	coverage := newCoverageMap(150, 4)
+	coverage.add(EncodedArea{X: 0, Y: 0, W: 70, H: 1})
+	coverage.add(EncodedArea{X: 130, Y: 0, W: 20, H: 2})
+
+	util.AssertEqual(t, 70, coverage.minUncoveredPixelX)
+	util.AssertEqual(t, 0, coverage.minUncoveredPixelY)
+	util.AssertEqual(t, 60, coverage.freeRunWidth(70, 0))
+	util.AssertEqual(t, 2, coverage.freeRunWidth(128, 0))
+	util.AssertEqual(t, 20, coverage.freeRunWidth(130, 2))
+	util.AssertTrue(t, coverage.isCovered(69, 0))
+	util.AssertFalse(t, coverage.isCovered(70, 0))
+
+	coverage.add(EncodedArea{X: 70, Y: 0, W: 60, H: 1})
+	util.AssertEqual(t, 0, coverage.minUncoveredPixelX)
+	util.AssertEqual(t, 1, coverage.minUncoveredPixelY)
+
+	coverage.add(EncodedArea{X: 0, Y: 1, W: 130, H: 3})
+	util.AssertEqual(t, 130, coverage.minUncoveredPixelX)
+	util.AssertEqual(t, 2, coverage.minUncoveredPixelY)
+
+	coverage.add(EncodedArea{X: 130, Y: 2, W: 20, H: 2})
+	util.AssertEqual(t, -1, coverage.minUncoveredPixelX)
+	util.AssertEqual(t, -1, coverage.minUncoveredPixelY)
+	util.AssertNil(t, coverage.ensureComplete())
+}
+
+func Test_coverageMap_ensureFree(t *testing.T) {
+	coverage := newCoverageMap(100, 4)
+	coverage.add(EncodedArea{X: 66, Y: 2, W: 3, H: 1})
+
+	util.AssertNil(t, coverage.ensureFree(EncodedArea{X: 0, Y: 0, W: 100, H: 2}))
+	util.AssertNil(t, coverage.ensureFree(EncodedArea{X: 0, Y: 2, W: 66, H: 2}))
+	err := coverage.ensureFree(EncodedArea{X: 60, Y: 1, W: 10, H: 3})
+	util.AssertError(t, "Area at (60, 1) with size 10x3 overlaps covered pixel (66, 2)", err)
+}
+
+// newTestImage creates an image with gradients, a flat region and some noise, so that the encoder produces areas of
+// various sizes.
+func newTestImage(width, height int) *image.Image {
+	random := rand.New(rand.NewSource(42))
+	img := image.New(width, height)
+
+	for x := 0; x < width; x++ {
+		img.R[x] = make([]uint8, height)
+		img.G[x] = make([]uint8, height)
+		img.B[x] = make([]uint8, height)
+		img.A[x] = make([]uint8, height)
+
+		for y := 0; y < height; y++ {
+			img.R[x][y] = uint8(x * 255 / width)
+			img.G[x][y] = uint8(y * 255 / height)
+			img.B[x][y] = 100
+			if x > width/2 && y > height/2 {
+				img.B[x][y] = uint8(random.Intn(256))
+			}
+			img.A[x][y] = 255
+		}
+	}
+
+	return img
+}
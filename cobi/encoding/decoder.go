@@ -2,21 +2,34 @@ package encoding
 
 import (
 	"cobi/image"
+	"cobi/interpolate"
 	"fmt"
 	"github.com/pkg/errors"
 )
 
-func Decode(areas [4][]EncodedArea) (*image.Image, error) {
+// DecodeAreas creates the image described by the encoded areas of the channels R (0), G (1), B (2) and A (3), which
+// are interpolated bilinearly.
+func DecodeAreas(areas [4][]EncodedArea) (*image.Image, error) {
+	return decodeAreas(areas, false, interpolate.BilinearKernel{})
+}
+
+// DecodeMeshAreas creates the image described by the encoded areas, whose values are vertices of a mesh
+// (s. EncodedImage.Mesh).
+func DecodeMeshAreas(areas [4][]EncodedArea) (*image.Image, error) {
+	return decodeAreas(areas, true, interpolate.BilinearKernel{})
+}
+
+func decodeAreas(areas [4][]EncodedArea, mesh bool, kernel interpolate.Kernel) (*image.Image, error) {
 	width, height, err := getAndEnsureWidthHeight(areas)
 	if err != nil {
 		return nil, err
 	}
 
 	img := image.New(width, height)
-	img.R = interpolateChannel(areas[0], width, height)
-	img.G = interpolateChannel(areas[1], width, height)
-	img.B = interpolateChannel(areas[2], width, height)
-	img.A = interpolateChannel(areas[3], width, height)
+	img.R = interpolateChannel(areas[0], width, height, mesh, kernel)
+	img.G = interpolateChannel(areas[1], width, height, mesh, kernel)
+	img.B = interpolateChannel(areas[2], width, height, mesh, kernel)
+	img.A = interpolateChannel(areas[3], width, height, mesh, kernel)
 	return img, nil
 }
 
@@ -53,8 +66,8 @@ func getSizeOfChannel(areas []EncodedArea) (int, int, error) {
 	height := 0
 
 	for _, area := range areas {
-		areaWidth := int(area.W)
-		areaHeight := int(area.H)
+		areaWidth := area.W
+		areaHeight := area.H
 
 		if width < area.X+areaWidth {
 			width = area.X + areaWidth
@@ -72,7 +85,7 @@ func getSizeOfChannel(areas []EncodedArea) (int, int, error) {
 	return width, height, nil
 }
 
-func interpolateChannel(areas []EncodedArea, width, height int) [][]uint8 {
+func interpolateChannel(areas []EncodedArea, width, height int, mesh bool, kernel interpolate.Kernel) [][]uint8 {
 	result := make([][]uint8, width)
 
 	for x := 0; x < width; x++ {
@@ -80,10 +93,10 @@ func interpolateChannel(areas []EncodedArea, width, height int) [][]uint8 {
 	}
 
 	for _, area := range areas {
-		interpolatedValues := area.GetInterpolatedArea()
+		interpolatedValues := interpolateArea(area, mesh, kernel)
 
-		for x := 0; x < int(area.W); x++ {
-			for y := 0; y < int(area.H); y++ {
+		for x := 0; x < area.W; x++ {
+			for y := 0; y < area.H; y++ {
 				result[x+area.X][y+area.Y] = interpolatedValues[x][y]
 			}
 		}
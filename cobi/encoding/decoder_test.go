@@ -5,7 +5,7 @@ import (
 	"testing"
 )
 
-func Test_decode(t *testing.T) {
+func Test_decodeAreas(t *testing.T) {
 	// 11111222
 	// 11111222
 	// 11111222
@@ -22,11 +22,11 @@ func Test_decode(t *testing.T) {
 		{0, 2, 5, 7, 10, 12, 13, 14},
 		{1, 3, 6, 9, 12, 15, 13, 12},
 		{2, 5, 8, 11, 15, 18, 14, 10},
-		{3, 7, 10, 13, 17, 19, 19, 19},
-		{5, 9, 12, 16, 20, 20, 20, 20},
+		{3, 6, 10, 13, 17, 19, 19, 19},
+		{5, 8, 12, 16, 20, 20, 20, 20},
 	})
 
-	img, err := Decode([4][]EncodedArea{
+	img, err := DecodeAreas([4][]EncodedArea{
 		areas,
 		areas,
 		areas,
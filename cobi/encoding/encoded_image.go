@@ -0,0 +1,132 @@
+package encoding
+
+import (
+	"cobi/image"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// EncodedImage is the in-memory representation of a .cobi file.
+type EncodedImage struct {
+	Width  int
+	Height int
+	// Areas contains the encoded areas per color channel R (0), G (1), B (2) and A (3).
+	Areas [4][]EncodedArea
+	// Residuals contains the differences between the original values and the values interpolated from the areas per
+	// color channel. The differences wrap around, i.e. they are computed and applied modulo 256. Residuals are only
+	// stored for lossless images and are nil otherwise.
+	Residuals [4][][]uint8
+	// EntropyCoding determines how the areas are stored in a file.
+	EntropyCoding EntropyCoding
+	// Mesh is true when the values of the areas are the vertices of a mesh, which are shared between neighboring
+	// areas (s. meshPositions).
+	Mesh bool
+	// Partitioning determines how the areas are arranged and therefore how they are stored in a file.
+	Partitioning Partitioning
+	// Interpolation determines the kernel filling the areas from their values. Only the bilinear interpolation is
+	// supported in mesh mode.
+	Interpolation Interpolation
+}
+
+// IsLossless returns true when the image contains residuals, i.e. when it can be decoded bit-exactly.
+func (e *EncodedImage) IsLossless() bool {
+	return e.Residuals[0] != nil
+}
+
+// EncodeImage determines the encoded areas of the image and, in lossless mode, the residuals. The default options are
+// used when the given options are nil.
+func EncodeImage(img image.Image, options *Options) (*EncodedImage, error) {
+	if options == nil {
+		options = DefaultOptions()
+	}
+
+	areas, err := EncodeAreas(img, options)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedImage := &EncodedImage{
+		Width:         img.Width,
+		Height:        img.Height,
+		Areas:         areas,
+		EntropyCoding: options.EntropyCoding,
+		Mesh:          options.Mesh,
+		Partitioning:  options.getPartitioner().Partitioning(),
+		Interpolation: options.Interpolation,
+	}
+
+	if options.Lossless {
+		kernel := options.getKernel()
+		encodedImage.Residuals = [4][][]uint8{
+			calculateResidual(img.R, interpolateChannel(areas[0], img.Width, img.Height, options.Mesh, kernel)),
+			calculateResidual(img.G, interpolateChannel(areas[1], img.Width, img.Height, options.Mesh, kernel)),
+			calculateResidual(img.B, interpolateChannel(areas[2], img.Width, img.Height, options.Mesh, kernel)),
+			calculateResidual(img.A, interpolateChannel(areas[3], img.Width, img.Height, options.Mesh, kernel)),
+		}
+	}
+
+	return encodedImage, nil
+}
+
+// DecodeImage creates the image described by the encoded image. For lossless images, the residuals are added to the
+// interpolated values, which results in the original image.
+func DecodeImage(encodedImage *EncodedImage) (*image.Image, error) {
+	kernel, err := encodedImage.Interpolation.kernel(encodedImage.Mesh)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decodeAreas(encodedImage.Areas, encodedImage.Mesh, kernel)
+	if err != nil {
+		return nil, err
+	}
+	if img.Width == 0 && img.Height == 0 && (encodedImage.Width == 0 || encodedImage.Height == 0) {
+		// An empty image has no areas, so its size is only known from the encoded image
+		img = newEmptyImage(encodedImage.Width, encodedImage.Height)
+	}
+	if img.Width != encodedImage.Width || img.Height != encodedImage.Height {
+		return nil, errors.New(fmt.Sprintf("Areas cover %dx%d pixels but the image has a size of %dx%d", img.Width, img.Height, encodedImage.Width, encodedImage.Height))
+	}
+
+	if encodedImage.IsLossless() {
+		applyResidual(img.R, encodedImage.Residuals[0])
+		applyResidual(img.G, encodedImage.Residuals[1])
+		applyResidual(img.B, encodedImage.Residuals[2])
+		applyResidual(img.A, encodedImage.Residuals[3])
+	}
+
+	return img, nil
+}
+
+// newEmptyImage returns an image of the given size without pixels, i.e. the width or height is zero.
+func newEmptyImage(width, height int) *image.Image {
+	img := image.New(width, height)
+	for x := 0; x < width; x++ {
+		img.R[x] = []uint8{}
+		img.G[x] = []uint8{}
+		img.B[x] = []uint8{}
+		img.A[x] = []uint8{}
+	}
+	return img
+}
+
+// calculateResidual returns the differences (modulo 256) between the original and the interpolated values.
+func calculateResidual(original, interpolated [][]uint8) [][]uint8 {
+	residual := make([][]uint8, len(original))
+	for x := range original {
+		residual[x] = make([]uint8, len(original[x]))
+		for y := range original[x] {
+			residual[x][y] = original[x][y] - interpolated[x][y]
+		}
+	}
+	return residual
+}
+
+// applyResidual adds the residual (modulo 256) to the given values.
+func applyResidual(values, residual [][]uint8) {
+	for x := range values {
+		for y := range values[x] {
+			values[x][y] += residual[x][y]
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package encoding
+
+import (
+	"cobi/util"
+	"testing"
+)
+
+func Test_encodeAndDecodeImage_lossless(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	encodedImage, err := EncodeImage(*img, &Options{Quality: 0, Lossless: true})
+	util.AssertNil(t, err)
+	decodedImage, err := DecodeImage(encodedImage)
+
+	util.AssertNil(t, err)
+	util.AssertArrayEqual(t, img.R, decodedImage.R)
+	util.AssertArrayEqual(t, img.G, decodedImage.G)
+	util.AssertArrayEqual(t, img.B, decodedImage.B)
+	util.AssertArrayEqual(t, img.A, decodedImage.A)
+}
+
+func Test_encodeImage_lossy(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	encodedImage, err := EncodeImage(*img, nil)
+
+	util.AssertNil(t, err)
+	util.AssertFalse(t, encodedImage.IsLossless())
+	util.AssertEqual(t, 40, encodedImage.Width)
+	util.AssertEqual(t, 30, encodedImage.Height)
+}
@@ -5,22 +5,61 @@ import (
 	"cobi/interpolate"
 	"github.com/hauke96/sigolo"
 	"math"
+	"sync"
 )
 
 // EncodedArea represents
 type EncodedArea struct {
 	X, Y   int
-	W, H   uint8
+	W, H   int
 	Values [4]uint8
+	// Kind determines which of the values are stored, the values of the other corners are copies of the stored ones
+	// (s. AreaKind).
+	Kind AreaKind
+	// Pixels contains the pixels of a raw area column by column and is nil for all other kinds.
+	Pixels [][]uint8
+	// Midpoints contains the control values of a quadratic area besides its corners: The values in the middle of the
+	// upper edge, the left edge, the area, the right edge and the bottom edge (s. patch). They are zero for all other
+	// kinds.
+	Midpoints [5]uint8
 }
 
 func (e *EncodedArea) Contains(x, y int) bool {
-	return e.X <= x && x <= e.X+int(e.W)-1 &&
-		e.Y <= y && y <= e.Y+int(e.H)-1
+	return e.X <= x && x <= e.X+e.W-1 &&
+		e.Y <= y && y <= e.Y+e.H-1
 }
 
-func (e *EncodedArea) GetInterpolatedArea() [][]uint8 {
-	return interpolate.Interpolate(e.W, e.H, e.Values)
+// GetInterpolatedArea returns the pixels of the area. The pixels of bilinear, horizontal and vertical areas are filled
+// by the given kernel from the values, raw and quadratic areas don't depend on the kernel.
+func (e *EncodedArea) GetInterpolatedArea(kernel interpolate.Kernel) [][]uint8 {
+	switch e.Kind {
+	case RawArea:
+		return e.Pixels
+	case ConstantArea:
+		return interpolate.Constant(e.W, e.H, e.Values[0])
+	case HorizontalArea:
+		return interpolate.InterpolateHorizontal(kernel, e.W, e.H, e.Values[0], e.Values[1])
+	case VerticalArea:
+		return interpolate.InterpolateVertical(kernel, e.W, e.H, e.Values[0], e.Values[2])
+	case QuadraticArea:
+		return interpolate.InterpolateQuadratic(e.W, e.H, e.patch())
+	}
+	return interpolate.InterpolateWith(kernel, e.W, e.H, e.Values)
+}
+
+// patch returns the 3x3 control values of a quadratic area row by row (s. interpolate.InterpolateQuadratic).
+func (e *EncodedArea) patch() [9]uint8 {
+	return [9]uint8{
+		e.Values[0], e.Midpoints[0], e.Values[1],
+		e.Midpoints[1], e.Midpoints[2], e.Midpoints[3],
+		e.Values[2], e.Midpoints[4], e.Values[3],
+	}
+}
+
+// setPatch sets the corner values and midpoints of a quadratic area from its 3x3 control values.
+func (e *EncodedArea) setPatch(patch [9]uint8) {
+	e.Values = [4]uint8{patch[0], patch[2], patch[6], patch[8]}
+	e.Midpoints = [5]uint8{patch[1], patch[3], patch[4], patch[5], patch[7]}
 }
 
 func GetDebugImage(width, height int, areas [4][]EncodedArea) *image.Image {
@@ -48,9 +87,9 @@ func GetDebugImage(width, height int, areas [4][]EncodedArea) *image.Image {
 
 		for _, area := range areas[i] {
 			channel[area.X][area.Y] = 255
-			channel[area.X+int(area.W)-1][area.Y] = 255
-			channel[area.X][area.Y+int(area.H)-1] = 255
-			channel[area.X+int(area.W)-1][area.Y+int(area.H)-1] = 255
+			channel[area.X+area.W-1][area.Y] = 255
+			channel[area.X][area.Y+area.H-1] = 255
+			channel[area.X+area.W-1][area.Y+area.H-1] = 255
 		}
 	}
 
@@ -63,197 +102,319 @@ func GetDebugImage(width, height int, areas [4][]EncodedArea) *image.Image {
 	return img
 }
 
+// ChannelEncoder evaluates the areas of a channel for a Partitioner. It determines the values of areas and whether
+// their interpolation is good enough according to the options of the encoder.
 type ChannelEncoder struct {
-	coveredPixel       [][]bool
-	minUncoveredPixelX int
-	minUncoveredPixelY int
-	imageWidth         int
-	imageHeight        int
-	channel            [][]uint8
+	imageWidth       int
+	imageHeight      int
+	channel          [][]uint8
+	qualityThreshold float64
+	costFunc         AreaCostFunc
+	maxPixelError    int
+	kernel           interpolate.Kernel
+	// vertices contains the known vertex values in mesh mode and is nil otherwise.
+	vertices *vertexTable
+	// integral contains the summed-area tables of the channel, which are used to fit the values of areas and, for a
+	// SquaredErrorCostFunc, to determine their cost.
+	integral *integralImage
 }
 
-func newChannelEncoder(width, height int, channel [][]uint8) *ChannelEncoder {
-	coveredPixel := make([][]bool, width)
-	for x := 0; x < width; x++ {
-		coveredPixel[x] = make([]bool, height)
+func newChannelEncoder(width, height int, channel [][]uint8, options *Options) *ChannelEncoder {
+	var vertices *vertexTable
+	if options.Mesh {
+		vertices = newVertexTable(width, height)
 	}
 
+	costFunc := options.getCostFunc()
 	return &ChannelEncoder{
-		coveredPixel:       coveredPixel,
-		minUncoveredPixelX: 0,
-		minUncoveredPixelY: 0,
-		imageWidth:         width,
-		imageHeight:        height,
-		channel:            channel,
+		imageWidth:       width,
+		imageHeight:      height,
+		channel:          channel,
+		qualityThreshold: costFunc.Threshold(options.Quality),
+		costFunc:         costFunc,
+		maxPixelError:    options.getMaxPixelError(),
+		kernel:           options.getKernel(),
+		vertices:         vertices,
+		integral:         newIntegralImage(channel, width, height, !options.Mesh),
 	}
 }
 
-// Encode determines the encoded areas per color channel R (0), G (1), B (2) and A (3).
-func Encode(img image.Image) ([4][]EncodedArea, error) {
-	sigolo.Debug("Encode channel R")
-	channelR := newChannelEncoder(img.Width, img.Height, img.R).encodeChannel(img.R)
-
-	sigolo.Debug("Encode channel G")
-	channelG := newChannelEncoder(img.Width, img.Height, img.G).encodeChannel(img.G)
+// channelNames contains the names of the color channels used in log messages.
+var channelNames = [4]string{"R", "G", "B", "A"}
 
-	sigolo.Debug("Encode channel B")
-	channelB := newChannelEncoder(img.Width, img.Height, img.B).encodeChannel(img.B)
+// stripJob is the encoding of one horizontal strip of a channel. Without strips, the strip covers the whole channel.
+type stripJob struct {
+	channelIndex int
+	stripIndex   int
+	y            int
+	height       int
+}
 
-	sigolo.Debug("Encode channel A")
-	channelA := newChannelEncoder(img.Width, img.Height, img.A).encodeChannel(img.A)
+// EncodeAreas determines the encoded areas per color channel R (0), G (1), B (2) and A (3). The default options are
+// used when the given options are nil.
+//
+// The channels and, when a strip height is set, the strips of each channel are independent of each other and are
+// encoded concurrently by the number of workers given in the options. The areas of the strips are concatenated from
+// top to bottom, which is the order a sequential encoder would produce. The result is therefore the same for any
+// number of workers.
+func EncodeAreas(img image.Image, options *Options) ([4][]EncodedArea, error) {
+	if options == nil {
+		options = DefaultOptions()
+	}
+	err := options.validate()
+	if err != nil {
+		return [4][]EncodedArea{}, err
+	}
 
-	return [4][]EncodedArea{
-		channelR,
-		channelG,
-		channelB,
-		channelA,
-	}, nil
-}
+	channels := [4][][]uint8{img.R, img.G, img.B, img.A}
+	stripHeight := options.getStripHeight(img.Height)
+	numberOfStrips := 0
+	if stripHeight > 0 {
+		numberOfStrips = (img.Height + stripHeight - 1) / stripHeight
+	}
 
-func (e *ChannelEncoder) encodeChannel(values [][]uint8) []EncodedArea {
-	var result []EncodedArea
+	var stripAreas [4][][]EncodedArea
+	jobs := make(chan stripJob, len(channels)*numberOfStrips)
+	for i := range channels {
+		stripAreas[i] = make([][]EncodedArea, numberOfStrips)
+		for j := 0; j < numberOfStrips; j++ {
+			y := j * stripHeight
+			height := int(math.Min(float64(stripHeight), float64(img.Height-y)))
+			jobs <- stripJob{channelIndex: i, stripIndex: j, y: y, height: height}
+		}
+	}
+	close(jobs)
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < options.getWorkers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				sigolo.Debug("Encode channel %s, rows %d to %d", channelNames[job.channelIndex], job.y, job.y+job.height-1)
+				// Each job writes to its own slot, so no further synchronization is needed
+				stripAreas[job.channelIndex][job.stripIndex] = encodeStrip(img.Width, channels[job.channelIndex], job, options)
+			}
+		}()
+	}
+	wg.Wait()
 
-	for {
-		area := e.findLargestNonEncodedArea(values, result)
-		if area == nil {
-			break
+	var result [4][]EncodedArea
+	for i := range stripAreas {
+		for _, areas := range stripAreas[i] {
+			result[i] = append(result[i], areas...)
 		}
-		result = append(result, *area)
 	}
 
-	return result
+	return result, nil
 }
 
-// findLargestNonEncodedArea finds the next encoded area following the strategy to find areas from the upper-left to the
-// bottom-right of the image.
-func (e *ChannelEncoder) findLargestNonEncodedArea(values [][]uint8, areas []EncodedArea) *EncodedArea {
-	areaX, areaY := e.minUncoveredPixelX, e.minUncoveredPixelY
-	if areaX == -1 || areaY == -1 {
-		return nil
-	}
-
-	areaWidth, areaHeight := e.getAreaSize(areaX, areaY)
-
-	encodedArea := &EncodedArea{
-		X: areaX,
-		Y: areaY,
-		W: areaWidth,
-		H: areaHeight,
-		Values: [4]uint8{
-			values[areaX][areaY],
-			values[areaX+int(areaWidth)-1][areaY],
-			values[areaX][areaY+int(areaHeight)-1],
-			values[areaX+int(areaWidth)-1][areaY+int(areaHeight)-1],
-		},
+// encodeStrip encodes the rows of the channel covered by the job as if they were a separate image. The positions of
+// the resulting areas are relative to the whole channel.
+func encodeStrip(width int, channel [][]uint8, job stripJob, options *Options) []EncodedArea {
+	strip := make([][]uint8, width)
+	for x := range strip {
+		strip[x] = channel[x][job.y : job.y+job.height]
 	}
 
-	e.addToCoverageMap(*encodedArea)
+	areas := options.getPartitioner().Partition(newChannelEncoder(width, job.height, strip, options))
+	for i := range areas {
+		areas[i].Y += job.y
+	}
+
+	return areas
+}
+
+// Width returns the width of the channel.
+func (e *ChannelEncoder) Width() int {
+	return e.imageWidth
+}
 
-	return encodedArea
+// Height returns the height of the channel.
+func (e *ChannelEncoder) Height() int {
+	return e.imageHeight
 }
 
-func (e *ChannelEncoder) addToCoverageMap(encodedArea EncodedArea) {
-	for y := encodedArea.Y; y < encodedArea.Y+int(encodedArea.H); y++ {
-		for x := encodedArea.X; x < encodedArea.X+int(encodedArea.W); x++ {
-			e.coveredPixel[x][y] = true
+// NewArea creates the area at the given position with the values determined by the encoder. In mesh mode, the
+// vertices of the area become known, which affects the values of subsequent areas. Therefore, areas must be created
+// in the order in which they are returned by the partitioner, and only once.
+//
+// Outside the mesh mode, the area gets the first kind of simplifiedAreaKinds, which is still acceptable. Otherwise, it
+// is a bilinear area or, when only the quadratic patch is acceptable, a quadratic area. In mesh mode, all areas are
+// bilinear since their values belong to shared vertices.
+func (e *ChannelEncoder) NewArea(x, y, width, height int) EncodedArea {
+	area := EncodedArea{
+		X:      x,
+		Y:      y,
+		W:      width,
+		H:      height,
+		Values: e.getValues(x, y, width, height, BilinearArea),
+	}
+
+	if e.vertices != nil {
+		e.vertices.add(area)
+		return area
+	}
+
+	for _, kind := range simplifiedAreaKinds {
+		values := e.getValues(x, y, width, height, kind)
+		if e.isAcceptable(x, y, width, height, values) {
+			area.Kind = kind
+			area.Values = values
+			return area
 		}
 	}
-	e.minUncoveredPixelX, e.minUncoveredPixelY = e.findMinUncoveredPixel()
-}
 
-// findMinUncoveredPixel determines the smallest pixel that is not covered by any area. It is assumed that the encoded
-// areas grow from the upper-left to the bottom-right. This means for example, when (3, 5) is the first non-covered
-// pixel, all pixels in rows 0, 1 or 2 are covered and all pixels of row 3 in columns 0-4 are covered.
-func (e *ChannelEncoder) findMinUncoveredPixel() (int, int) {
-	for y := e.minUncoveredPixelY; y < e.imageHeight; y++ {
-		for x := 0; x < e.imageWidth; x++ {
-			if !e.coveredPixel[x][y] {
-				return x, y
-			}
+	if e.supportsQuadraticArea(width, height) && !e.isAcceptable(x, y, width, height, area.Values) {
+		patch, squaredError := e.integral.fitQuadraticValues(x, y, width, height)
+		if e.isAcceptablePatch(x, y, width, height, patch, squaredError) {
+			area.Kind = QuadraticArea
+			area.setPatch(patch)
 		}
 	}
 
-	// No pixel has been found that's not covered
-	return -1, -1
+	return area
 }
 
-func (e *ChannelEncoder) getAreaSize(x, y int) (uint8, uint8) {
-	// TODO make this configurable
-	qualityThreshold := 0.005
+// NewRawArea creates the raw area at the given position, which contains the pixels of the channel (s. RawArea). Raw
+// areas must only be created when they are supported (s. SupportsRawAreas).
+func (e *ChannelEncoder) NewRawArea(x, y, width, height int) EncodedArea {
+	pixels := make([][]uint8, width)
+	for i := range pixels {
+		pixels[i] = make([]uint8, height)
+		copy(pixels[i], e.channel[x+i][y:y+height])
+	}
 
-	maxWidthInt := 0
-	for ; x+maxWidthInt < e.imageWidth && maxWidthInt < math.MaxUint8; maxWidthInt++ {
-		if e.coveredPixel[x+maxWidthInt][y] {
-			break
-		}
+	return EncodedArea{
+		X:      x,
+		Y:      y,
+		W:      width,
+		H:      height,
+		Kind:   RawArea,
+		Pixels: pixels,
 	}
+}
 
-	width := 1
-	height := 1
+// SupportsRawAreas returns true when raw areas can be used. This is not the case in mesh mode, where all areas are
+// bilinear.
+func (e *ChannelEncoder) SupportsRawAreas() bool {
+	return e.vertices == nil
+}
 
-	// Go through all forms of rectangles. For d=5 for example: 1x4, 2x3, 3x2, 4x1
-	for d := 2; d < math.MaxUint8; d++ {
-		foundLargerArea := false
-		for w := 1; w < d && w < maxWidthInt; w++ {
-			h := d - w
+// IsAcceptable determines whether the interpolation of the given area is good enough, i.e. whether its cost is below
+// the quality threshold and, in near-lossless mode, no pixel exceeds the maximum pixel error. Areas, whose bilinear
+// interpolation is not good enough, are acceptable as quadratic areas, if their quadratic patch is good enough.
+func (e *ChannelEncoder) IsAcceptable(x, y, width, height int) bool {
+	if e.isAcceptable(x, y, width, height, e.getValues(x, y, width, height, BilinearArea)) {
+		return true
+	}
+	if !e.supportsQuadraticArea(width, height) {
+		return false
+	}
 
-			if y+int(h) >= e.imageHeight {
-				h = e.imageHeight - y - 1
-			}
+	patch, squaredError := e.integral.fitQuadraticValues(x, y, width, height)
+	return e.isAcceptablePatch(x, y, width, height, patch, squaredError)
+}
 
-			// Only consider larger areas
-			if width*height <= w*h {
-				quality := e.calculateInterpolationQuality(x, y, x+int(w), y+int(h))
-				if quality < qualityThreshold {
-					width = w
-					height = h
-					foundLargerArea = true
-				}
-			}
-		}
-		if !foundLargerArea {
-			break
+// isAcceptable determines whether the interpolation of the given values by the kernel is good enough
+// (s. IsAcceptable). The squared error is only determined from the summed-area tables for the bilinear kernel, other
+// kernels are interpolated to determine it.
+func (e *ChannelEncoder) isAcceptable(x, y, width, height int, values [4]uint8) bool {
+	interpolateArea := func() [][]uint8 {
+		if e.vertices != nil {
+			return interpolate.InterpolateMesh(width, height, values)
 		}
+		return interpolate.InterpolateWith(e.kernel, width, height, values)
 	}
 
-	// TODO HACK: Why do many areas fulfill this?
-	if maxWidthInt-width <= 2 {
-		width = maxWidthInt
+	squaredError := func() float64 {
+		return e.integral.squaredError(x, y, width, height, values, e.vertices != nil)
 	}
+	if e.kernel != (interpolate.BilinearKernel{}) {
+		squaredError = func() float64 {
+			return squaredErrorSum(e.channel, x, y, interpolateArea())
+		}
+	}
+
+	return e.isAcceptableInterpolation(x, y, width, height, squaredError, interpolateArea)
+}
 
-	return uint8(width), uint8(height)
+// isAcceptablePatch determines whether the quadratic patch with the given squared error is good enough
+// (s. IsAcceptable).
+func (e *ChannelEncoder) isAcceptablePatch(x, y, width, height int, patch [9]uint8, squaredError float64) bool {
+	return e.isAcceptableInterpolation(x, y, width, height,
+		func() float64 {
+			return squaredError
+		},
+		func() [][]uint8 {
+			return interpolate.InterpolateQuadratic(width, height, patch)
+		})
 }
 
-func (e *ChannelEncoder) calculateInterpolationQuality(x1, y1, x2, y2 int) float64 {
-	width := uint8(x2 - x1)
-	height := uint8(y2 - y1)
-	interpolatedData := interpolate.Interpolate(width, height, [4]uint8{
-		e.channel[x1][y1],
-		e.channel[x2][y1],
-		e.channel[x1][y2],
-		e.channel[x2][y2],
-	})
-
-	summedDifferences := 0.0
-	for y := y1; y < y2; y++ {
-		for x := x1; x < x2; x++ {
-			diff := math.Abs(float64(e.channel[x][y]) - float64(interpolatedData[x-x1][y-y1]))
-			summedDifferences += diff
+// isAcceptableInterpolation determines whether the interpolation of the area is good enough. The squared error is used
+// for a SquaredErrorCostFunc, the interpolated values only when they are needed for the cost or the maximum pixel
+// error.
+func (e *ChannelEncoder) isAcceptableInterpolation(x, y, width, height int, squaredError func() float64, interpolateArea func() [][]uint8) bool {
+	costFunc, isSquaredErrorCostFunc := e.costFunc.(SquaredErrorCostFunc)
+	if isSquaredErrorCostFunc {
+		if costFunc.SquaredErrorCost(width, height, squaredError()) >= e.qualityThreshold {
+			return false
+		}
+		if e.maxPixelError < 0 {
+			return true
 		}
 	}
-	//maxNumberPixels := 255.0 * 255.0
-	numberPixels := float64(width) * float64(height)
-	normalizedDifferences := summedDifferences
-	normalizedDifferencesPerPixel := normalizedDifferences / numberPixels
 
-	max := math.Max(float64(width), float64(height))
-	min := math.Min(float64(width), float64(height))
+	interpolatedData := interpolateArea()
+	if e.maxPixelError >= 0 && exceedsMaxPixelError(e.channel, x, y, interpolatedData, e.maxPixelError) {
+		return false
+	}
+
+	return isSquaredErrorCostFunc || e.costFunc.Cost(e.channel, x, y, interpolatedData) < e.qualityThreshold
+}
+
+// supportsQuadraticArea returns true when the area of the given size can be a quadratic area. Quadratic areas are not
+// supported in mesh mode, where all areas are bilinear.
+func (e *ChannelEncoder) supportsQuadraticArea(width, height int) bool {
+	return e.vertices == nil &&
+		width >= minQuadraticAreaSize && height >= minQuadraticAreaSize &&
+		width <= maxQuadraticAreaSize && height <= maxQuadraticAreaSize
+}
 
-	// Penalty for large areas as they would otherwise create large artifacts
-	sizeFactor := (max * min) / (255.0 * max)
+// getValues returns the values of the given area of the given kind, which are fitted to its pixels
+// (s. integralImage.fitValues). In mesh mode, the values of unknown vertices are the pixels at their positions
+// (s. vertexTable.sample). They are shared with the subsequent areas, so fitting them to the current area only would
+// make these areas worse.
+// The values of the nearest-corner kernel are fitted separately (s. integralImage.fitNearestCornerValues), all other
+// kernels use the values fitted to the bilinear interpolation.
+func (e *ChannelEncoder) getValues(x, y, width, height int, kind AreaKind) [4]uint8 {
+	if e.vertices != nil {
+		values, _ := e.vertices.sample(e.channel, x, y, width, height)
+		return values
+	}
+	if e.kernel == (interpolate.NearestCornerKernel{}) {
+		return e.integral.fitNearestCornerValues(x, y, width, height, kind)
+	}
 
-	// Penalty for non-squared areas (i.e. rectangles with a very long and a very short edge)
-	squareFactor := max / min
+	values := [4]uint8{
+		e.channel[x][y],
+		e.channel[x+width-1][y],
+		e.channel[x][y+height-1],
+		e.channel[x+width-1][y+height-1],
+	}
+	return e.integral.fitValues(x, y, width, height, values, [4]bool{}, kind, false)
+}
 
-	return math.Pow(normalizedDifferencesPerPixel, 2) * math.Pow(squareFactor, 2) * math.Pow(sizeFactor, 2)
+// exceedsMaxPixelError returns true when at least one interpolated value deviates from the original value by more
+// than the given maximum error.
+func exceedsMaxPixelError(channel [][]uint8, x, y int, interpolated [][]uint8, maxError int) bool {
+	for ax := range interpolated {
+		for ay := range interpolated[ax] {
+			diff := int(channel[x+ax][y+ay]) - int(interpolated[ax][ay])
+			if diff > maxError || -diff > maxError {
+				return true
+			}
+		}
+	}
+	return false
 }
@@ -1,7 +1,9 @@
 package encoding
 
 import (
+	"cobi/image"
 	"cobi/util"
+	"math"
 	"testing"
 )
 
@@ -37,43 +39,171 @@ func Test_encodedArea_contains(t *testing.T) {
 	util.AssertFalse(t, area.Contains(7, 4))
 }
 
-func Test_findLargestNonEncodedArea(t *testing.T) {
-	// 11112223
-	// 11112223
-	// 1111...3
-	// 1111....
-	// ........
-	// ........
-	// ........
-	// ........
-	areas := []EncodedArea{
-		{X: 0, Y: 0, W: 4, H: 5}, // 1
-		{X: 4, Y: 0, W: 3, H: 2}, // 3
-		{X: 7, Y: 0, W: 1, H: 3}, // 2
+func Test_qualityThreshold(t *testing.T) {
+	util.AssertEqual(t, 0.5, qualityThreshold(0))
+	util.AssertTrue(t, math.Abs(qualityThreshold(DefaultQuality)-0.005) < 1e-12)
+	util.AssertTrue(t, math.Abs(qualityThreshold(100)-0.00005) < 1e-12)
+}
+
+func Test_encodeAreas_higherQualityResultsInMoreSymbols(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	lowQualityAreas, err := EncodeAreas(*img, &Options{Quality: 10})
+	util.AssertNil(t, err)
+	highQualityAreas, err := EncodeAreas(*img, &Options{Quality: 90})
+	util.AssertNil(t, err)
+
+	// Tiny areas are replaced by raw areas, which reduces the number of areas and can even reduce the number of stored
+	// symbols of a channel (like the noise of the blue channel), but not of the whole image.
+	imageSymbols := func(areas [4][]EncodedArea) int {
+		symbols := 0
+		for i := range areas {
+			for _, area := range areas[i] {
+				symbols += storedSymbols(area)
+			}
+		}
+		return symbols
+	}
+	util.AssertTrue(t, imageSymbols(lowQualityAreas) < imageSymbols(highQualityAreas))
+	util.AssertTrue(t, len(lowQualityAreas[0]) < len(highQualityAreas[0]))
+}
+
+func Test_encodeAreas_invalidQuality(t *testing.T) {
+	_, err := EncodeAreas(*newTestImage(4, 4), &Options{Quality: 101})
+
+	util.AssertError(t, "Quality must be between 0 and 100 but was 101", err)
+}
+
+func Test_encodeAreas_nearLossless(t *testing.T) {
+	img := newTestImage(40, 30)
+	// Thin line, which would vanish within a large area with low quality
+	for y := 0; y < img.Height; y++ {
+		img.G[20][y] = 255
 	}
-	values := util.TransposeArray([][]uint8{
-		{0, 1, 2, 3, 4, 5, 6, 7},
-		{0, 1, 2, 3, 4, 5, 6, 7},
-		{0, 1, 2, 3, 4, 5, 6, 7},
-		{0, 1, 2, 3, 4, 5, 6, 7},
-		{0, 1, 2, 3, 4, 5, 6, 7},
-		{0, 1, 2, 3, 4, 5, 6, 7},
-		{0, 1, 2, 3, 4, 5, 6, 7},
-		{0, 1, 2, 3, 4, 5, 6, 7},
-	})
-
-	encoder := newChannelEncoder(8, 8)
-	encoder.addToCoverageMap(areas[0])
-	encoder.addToCoverageMap(areas[1])
-	encoder.addToCoverageMap(areas[2])
-
-	newArea := *(encoder.findLargestNonEncodedArea(values, areas))
-
-	util.AssertEqual(t, 4, newArea.X)
-	util.AssertEqual(t, 2, newArea.Y)
-	util.AssertEqual(t, 3, newArea.W)
-	util.AssertEqual(t, 3, newArea.H)
-	util.AssertEqual(t, [4]uint8{4, 6, 4, 6}, newArea.Values)
-	util.AssertEqual(t, encoder.minUncoveredPixelX, 7)
-	util.AssertEqual(t, encoder.minUncoveredPixelY, 3)
+
+	for _, maxPixelError := range []int{0, 4, 20} {
+		areas, err := EncodeAreas(*img, &Options{Quality: 0, NearLossless: true, MaxPixelError: maxPixelError})
+		util.AssertNil(t, err)
+		decodedImage, err := DecodeAreas(areas)
+		util.AssertNil(t, err)
+
+		original := [][][]uint8{img.R, img.G, img.B, img.A}
+		decoded := [][][]uint8{decodedImage.R, decodedImage.G, decodedImage.B, decodedImage.A}
+		for i := range original {
+			util.AssertFalse(t, exceedsMaxPixelError(original[i], 0, 0, decoded[i], maxPixelError))
+		}
+	}
+}
+
+func Test_encodeAreas_invalidMaxPixelError(t *testing.T) {
+	_, err := EncodeAreas(*newTestImage(4, 4), &Options{NearLossless: true, MaxPixelError: -1})
+
+	util.AssertError(t, "Maximum pixel error must be between 0 and 255 but was -1", err)
+}
+
+func Test_encodeAreas_largeUniformImage(t *testing.T) {
+	// Larger than the former limit of 255 pixels
+	img := image.New(300, 40)
+	for x := 0; x < img.Width; x++ {
+		img.R[x] = make([]uint8, img.Height)
+		img.G[x] = make([]uint8, img.Height)
+		img.B[x] = make([]uint8, img.Height)
+		img.A[x] = make([]uint8, img.Height)
+		for y := 0; y < img.Height; y++ {
+			img.R[x][y] = 100
+			img.A[x][y] = 255
+		}
+	}
+
+	areas, err := EncodeAreas(*img, nil)
+
+	util.AssertNil(t, err)
+	for i := range areas {
+		util.AssertEqual(t, 1, len(areas[i]))
+	}
+	util.AssertDeepEqual(t, EncodedArea{X: 0, Y: 0, W: 300, H: 40, Values: [4]uint8{100, 100, 100, 100}, Kind: ConstantArea}, areas[0][0])
+}
+
+func Test_encodeAreas_quadraticAreas(t *testing.T) {
+	// A vignette, which is bright in the center and darker towards the borders
+	img := image.New(60, 40)
+	for x := 0; x < img.Width; x++ {
+		img.R[x] = make([]uint8, img.Height)
+		img.G[x] = make([]uint8, img.Height)
+		img.B[x] = make([]uint8, img.Height)
+		img.A[x] = make([]uint8, img.Height)
+		for y := 0; y < img.Height; y++ {
+			img.R[x][y] = uint8(250 - ((x-30)*(x-30)+(y-20)*(y-20))/8)
+			img.A[x][y] = 255
+		}
+	}
+
+	for _, partitioner := range Partitioners {
+		areas, err := EncodeAreas(*img, &Options{Quality: 90, Partitioner: partitioner})
+		util.AssertNil(t, err)
+
+		quadraticAreas := 0
+		for _, area := range areas[0] {
+			if area.Kind == QuadraticArea {
+				quadraticAreas++
+			}
+		}
+		util.AssertTrue(t, quadraticAreas > 0)
+
+		// Fewer areas than with the bilinear areas of the mesh mode, which has no quadratic areas
+		meshAreas, err := EncodeAreas(*img, &Options{Quality: 90, Partitioner: partitioner, Mesh: true})
+		util.AssertNil(t, err)
+		for _, area := range meshAreas[0] {
+			util.AssertEqual(t, BilinearArea, area.Kind)
+		}
+		util.AssertTrue(t, len(areas[0]) < len(meshAreas[0]))
+	}
+}
+
+func Test_encodeAreas_workersProduceSameResult(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	for _, stripHeight := range []int{0, 7} {
+		expectedAreas, err := EncodeAreas(*img, &Options{Quality: 50, Workers: 1, StripHeight: stripHeight})
+		util.AssertNil(t, err)
+
+		for _, workers := range []int{0, 2, 8} {
+			areas, err := EncodeAreas(*img, &Options{Quality: 50, Workers: workers, StripHeight: stripHeight})
+			util.AssertNil(t, err)
+			assertAreasEqual(t, expectedAreas, areas)
+		}
+	}
+}
+
+func Test_encodeAreas_strips(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	areas, err := EncodeAreas(*img, &Options{Quality: 0, StripHeight: 7})
+	util.AssertNil(t, err)
+
+	for i := range areas {
+		for _, area := range areas[i] {
+			// No area crosses the border of a strip
+			util.AssertEqual(t, area.Y/7, (area.Y+area.H-1)/7)
+		}
+
+		err = restoreAreaPositions(areas[i], img.Width, img.Height)
+		util.AssertNil(t, err)
+	}
+	decodedImage, err := DecodeAreas(areas)
+	util.AssertNil(t, err)
+	util.AssertEqual(t, 30, decodedImage.Height)
+}
+
+func Test_encodeAreas_invalidWorkersAndStrips(t *testing.T) {
+	img := newTestImage(4, 4)
+
+	_, err := EncodeAreas(*img, &Options{Workers: -1})
+	util.AssertError(t, "Number of workers must not be negative but was -1", err)
+
+	_, err = EncodeAreas(*img, &Options{StripHeight: -1})
+	util.AssertError(t, "Strip height must not be negative but was -1", err)
+
+	_, err = EncodeAreas(*img, &Options{StripHeight: 2, Mesh: true})
+	util.AssertError(t, "Strips can't be combined with the mesh mode", err)
 }
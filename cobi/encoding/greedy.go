@@ -0,0 +1,116 @@
+package encoding
+
+// GreedyPartitioner places the largest acceptable area at the first uncovered pixel (in scanline order) until the
+// whole channel is covered. Runs of tiny areas are then replaced by raw areas (s. mergeRawAreas). Its areas are stored
+// with GreedyPartitioning.
+type GreedyPartitioner struct{}
+
+func (p GreedyPartitioner) Partition(encoder *ChannelEncoder) []EncodedArea {
+	g := &greedyPartition{
+		encoder:  encoder,
+		coverage: newCoverageMap(encoder.Width(), encoder.Height()),
+	}
+
+	var result []EncodedArea
+	for {
+		area := g.findLargestNonEncodedArea()
+		if area == nil {
+			break
+		}
+		result = append(result, *area)
+	}
+
+	if encoder.SupportsRawAreas() {
+		result = mergeRawAreas(encoder, result)
+	}
+	return result
+}
+
+// mergeRawAreas replaces runs of tiny areas by one raw area each, when the raw area needs fewer symbols than the tiny
+// areas (s. storedSymbols). An area is tiny when it doesn't need fewer symbols than its pixels. A run consists of
+// consecutive tiny areas with the same row and height, which are next to each other. The raw area takes the place of
+// the first area of its run, which keeps the order of the greedy partitioning.
+func mergeRawAreas(encoder *ChannelEncoder, areas []EncodedArea) []EncodedArea {
+	isTiny := func(area EncodedArea) bool {
+		return storedSymbols(area) >= area.W*area.H
+	}
+
+	var result []EncodedArea
+	for i := 0; i < len(areas); {
+		first := areas[i]
+		end := i + 1
+		runSymbols := storedSymbols(first)
+		runWidth := first.W
+		for isTiny(first) && end < len(areas) && isTiny(areas[end]) && areas[end].Y == first.Y && areas[end].H == first.H && areas[end].X == first.X+runWidth {
+			runSymbols += storedSymbols(areas[end])
+			runWidth += areas[end].W
+			end++
+		}
+
+		rawArea := encoder.NewRawArea(first.X, first.Y, runWidth, first.H)
+		if end-i > 1 && storedSymbols(rawArea) < runSymbols {
+			result = append(result, rawArea)
+		} else {
+			result = append(result, areas[i:end]...)
+		}
+		i = end
+	}
+	return result
+}
+
+func (p GreedyPartitioner) Partitioning() Partitioning {
+	return GreedyPartitioning
+}
+
+// greedyPartition is the state of the GreedyPartitioner while partitioning one channel.
+type greedyPartition struct {
+	encoder  *ChannelEncoder
+	coverage *coverageMap
+}
+
+// findLargestNonEncodedArea finds the next encoded area following the strategy to find areas from the upper-left to the
+// bottom-right of the image.
+func (g *greedyPartition) findLargestNonEncodedArea() *EncodedArea {
+	areaX, areaY := g.coverage.minUncoveredPixelX, g.coverage.minUncoveredPixelY
+	if areaX == -1 || areaY == -1 {
+		return nil
+	}
+
+	areaWidth, areaHeight := g.getAreaSize(areaX, areaY)
+
+	encodedArea := g.encoder.NewArea(areaX, areaY, areaWidth, areaHeight)
+	g.coverage.add(encodedArea)
+
+	return &encodedArea
+}
+
+func (g *greedyPartition) getAreaSize(x, y int) (int, int) {
+	maxWidth := g.coverage.freeRunWidth(x, y)
+	maxHeight := g.encoder.Height() - y
+
+	width := 1
+	height := 1
+
+	// Go through all forms of rectangles. For d=5 for example: 1x4, 2x3, 3x2, 4x1
+	for d := 2; d <= maxWidth+maxHeight; d++ {
+		foundLargerArea := false
+		for w := 1; w < d && w <= maxWidth; w++ {
+			h := d - w
+			if h > maxHeight {
+				continue
+			}
+
+			// Only consider larger areas
+			if width*height <= w*h && g.encoder.IsAcceptable(x, y, w, h) {
+				width = w
+				height = h
+				foundLargerArea = true
+			}
+		}
+		if !foundLargerArea {
+			break
+		}
+	}
+
+	return width, height
+}
@@ -0,0 +1,160 @@
+package encoding
+
+import (
+	"cobi/interpolate"
+	"cobi/util"
+	"testing"
+)
+
+func Test_findLargestNonEncodedArea(t *testing.T) {
+	// 11112223
+	// 11112223
+	// 1111...3
+	// 1111....
+	// ........
+	// ........
+	// ........
+	// ........
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 4, H: 5}, // 1
+		{X: 4, Y: 0, W: 3, H: 2}, // 3
+		{X: 7, Y: 0, W: 1, H: 3}, // 2
+	}
+	values := util.TransposeArray([][]uint8{
+		{0, 1, 2, 3, 4, 5, 6, 7},
+		{0, 1, 2, 3, 4, 5, 6, 7},
+		{0, 1, 2, 3, 4, 5, 6, 7},
+		{0, 1, 2, 3, 4, 5, 6, 7},
+		{0, 1, 2, 3, 4, 5, 6, 7},
+		{0, 1, 2, 3, 4, 5, 6, 7},
+		{0, 1, 2, 3, 4, 5, 6, 7},
+		{0, 1, 2, 3, 4, 5, 6, 7},
+	})
+
+	g := &greedyPartition{
+		encoder:  newChannelEncoder(8, 8, values, DefaultOptions()),
+		coverage: newCoverageMap(8, 8),
+	}
+	g.coverage.add(areas[0])
+	g.coverage.add(areas[1])
+	g.coverage.add(areas[2])
+
+	newArea := *(g.findLargestNonEncodedArea())
+
+	util.AssertEqual(t, 4, newArea.X)
+	util.AssertEqual(t, 2, newArea.Y)
+	util.AssertEqual(t, 3, newArea.W)
+	util.AssertEqual(t, 6, newArea.H)
+	// The small gradient from 4 to 6 is approximated well enough by a constant area
+	util.AssertEqual(t, ConstantArea, newArea.Kind)
+	util.AssertEqual(t, [4]uint8{5, 5, 5, 5}, newArea.Values)
+	util.AssertEqual(t, g.coverage.minUncoveredPixelX, 7)
+	util.AssertEqual(t, g.coverage.minUncoveredPixelY, 3)
+}
+
+func Test_greedyPartition_getAreaSize(t *testing.T) {
+	// A gradient reaching the last row and column, followed by two columns of a different value
+	channel := make([][]uint8, 10)
+	for x := range channel {
+		channel[x] = make([]uint8, 8)
+		for y := range channel[x] {
+			channel[x][y] = uint8(10*x + 5*y)
+			if x >= 8 {
+				channel[x][y] = 255
+			}
+		}
+	}
+
+	g := &greedyPartition{
+		encoder:  newChannelEncoder(10, 8, channel, DefaultOptions()),
+		coverage: newCoverageMap(10, 8),
+	}
+
+	// The area covers the gradient including its last row but doesn't extend to the two different columns
+	width, height := g.getAreaSize(0, 0)
+	util.AssertEqual(t, 8, width)
+	util.AssertEqual(t, 8, height)
+
+	area := g.encoder.NewArea(0, 0, width, height)
+	interpolated := area.GetInterpolatedArea(interpolate.BilinearKernel{})
+	util.AssertArrayEqual(t, channel[:8], interpolated)
+}
+
+func Test_greedyPartition_getAreaSize_corners(t *testing.T) {
+	// A gradient covering the whole channel, which is surrounded by pixels of a different value in a larger channel
+	gradient := func(width, height int) [][]uint8 {
+		channel := make([][]uint8, width)
+		for x := range channel {
+			channel[x] = make([]uint8, height)
+			for y := range channel[x] {
+				channel[x][y] = uint8(20*x + 10*y)
+				if x >= 6 || y >= 5 {
+					channel[x][y] = 255
+				}
+			}
+		}
+		return channel
+	}
+
+	// Without near-lossless mode, the corners of a candidate area are its own corner pixels and not the pixels right
+	// of and below it. Therefore, an area can cover the last row and column of the channel but doesn't include the
+	// different pixels next to it.
+	for _, size := range [][2]int{{6, 5}, {7, 6}} {
+		g := &greedyPartition{
+			encoder:  newChannelEncoder(size[0], size[1], gradient(size[0], size[1]), DefaultOptions()),
+			coverage: newCoverageMap(size[0], size[1]),
+		}
+
+		width, height := g.getAreaSize(0, 0)
+		util.AssertEqual(t, 6, width)
+		util.AssertEqual(t, 5, height)
+	}
+}
+
+func Test_mergeRawAreas(t *testing.T) {
+	img := newTestImage(8, 4)
+	encoder := newChannelEncoder(8, 4, img.B, DefaultOptions())
+
+	// The first three areas form a run of tiny areas, the fourth one has a different height and the fifth one is not
+	// tiny.
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 1, H: 1, Kind: ConstantArea},
+		{X: 1, Y: 0, W: 2, H: 1, Kind: HorizontalArea},
+		{X: 3, Y: 0, W: 1, H: 1, Kind: ConstantArea},
+		{X: 4, Y: 0, W: 1, H: 2},
+		{X: 5, Y: 0, W: 3, H: 4, Kind: ConstantArea},
+	}
+
+	actual := mergeRawAreas(encoder, areas)
+
+	util.AssertEqual(t, 3, len(actual))
+	util.AssertDeepEqual(t, encoder.NewRawArea(0, 0, 4, 1), actual[0])
+	util.AssertDeepEqual(t, areas[3], actual[1])
+	util.AssertDeepEqual(t, areas[4], actual[2])
+}
+
+func Test_encodeAreas_rawAreas(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	for _, partitioner := range Partitioners {
+		areas, err := EncodeAreas(*img, &Options{Quality: 90, Partitioner: partitioner})
+		util.AssertNil(t, err)
+
+		// The noise of the blue channel is stored as raw pixels
+		rawPixels := 0
+		for _, area := range areas[2] {
+			if area.Kind == RawArea {
+				rawPixels += area.W * area.H
+				util.AssertArrayEqual(t, newChannelEncoder(40, 30, img.B, DefaultOptions()).NewRawArea(area.X, area.Y, area.W, area.H).Pixels, area.Pixels)
+			}
+		}
+		util.AssertTrue(t, rawPixels > 0)
+
+		// No raw areas in mesh mode
+		areas, err = EncodeAreas(*img, &Options{Quality: 90, Partitioner: partitioner, Mesh: true})
+		util.AssertNil(t, err)
+		for _, area := range areas[2] {
+			util.AssertEqual(t, BilinearArea, area.Kind)
+		}
+	}
+}
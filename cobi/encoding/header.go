@@ -0,0 +1,161 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// Magic is the byte sequence every .cobi file starts with.
+const Magic = "COBI"
+
+// formatVersion is the version of the container format written by this package. Files with a different version are
+// rejected by the reader.
+const formatVersion uint8 = 12
+
+// Flags of the header, which are combined into one byte.
+const (
+	// flagLossless marks files containing a residual layer (s. EncodedImage.Residuals).
+	flagLossless uint8 = 1 << iota
+	// flagMesh marks files whose areas share the values of their vertices (s. EncodedImage.Mesh).
+	flagMesh
+)
+
+// MaxPixels is the largest number of pixels (width times height) of an image, which can be read. Buffers of the image
+// size are allocated while reading, so this protects readers of untrusted data against headers claiming huge images.
+var MaxPixels = 1 << 27
+
+// numberOfChannels is the number of color channels (R, G, B and A) stored in a file.
+const numberOfChannels = 4
+
+// header is the first part of each .cobi file. It has the following layout (all numbers big-endian):
+//
+//	magic          4 bytes  "COBI"
+//	version        1 byte
+//	flags          1 byte   s. flag constants
+//	entropy coding 1 byte   s. EntropyCoding
+//	partitioning   1 byte   s. Partitioning
+//	interpolation  1 byte   s. Interpolation
+//	width          4 bytes
+//	height         4 bytes
+//	channel count  1 byte
+//	area counts    4 bytes per channel
+type header struct {
+	version       uint8
+	flags         uint8
+	entropyCoding EntropyCoding
+	partitioning  Partitioning
+	interpolation Interpolation
+	width         int
+	height        int
+	areaCounts    []int
+}
+
+func newHeader(encodedImage *EncodedImage) header {
+	areaCounts := make([]int, len(encodedImage.Areas))
+	for i, channel := range encodedImage.Areas {
+		areaCounts[i] = len(channel)
+	}
+
+	var flags uint8
+	if encodedImage.IsLossless() {
+		flags |= flagLossless
+	}
+	if encodedImage.Mesh {
+		flags |= flagMesh
+	}
+
+	return header{
+		version:       formatVersion,
+		flags:         flags,
+		entropyCoding: encodedImage.EntropyCoding,
+		partitioning:  encodedImage.Partitioning,
+		interpolation: encodedImage.Interpolation,
+		width:         encodedImage.Width,
+		height:        encodedImage.Height,
+		areaCounts:    areaCounts,
+	}
+}
+
+func (h header) hasFlag(flag uint8) bool {
+	return h.flags&flag != 0
+}
+
+func (h header) write(buffer *bytes.Buffer) {
+	buffer.WriteString(Magic)
+	buffer.WriteByte(h.version)
+	buffer.WriteByte(h.flags)
+	buffer.WriteByte(uint8(h.entropyCoding))
+	buffer.WriteByte(uint8(h.partitioning))
+	buffer.WriteByte(uint8(h.interpolation))
+	buffer.Write(binary.BigEndian.AppendUint32(nil, uint32(h.width)))
+	buffer.Write(binary.BigEndian.AppendUint32(nil, uint32(h.height)))
+	buffer.WriteByte(uint8(len(h.areaCounts)))
+	for _, count := range h.areaCounts {
+		buffer.Write(binary.BigEndian.AppendUint32(nil, uint32(count)))
+	}
+}
+
+func readHeader(reader io.Reader) (header, error) {
+	magic := make([]byte, len(Magic))
+	_, err := io.ReadFull(reader, magic)
+	if err != nil {
+		return header{}, errors.Wrap(err, "Could not read magic bytes")
+	}
+	if string(magic) != Magic {
+		return header{}, errors.New(fmt.Sprintf("Invalid magic bytes %q, this is not a cobi file", magic))
+	}
+
+	var version uint8
+	err = binary.Read(reader, binary.BigEndian, &version)
+	if err != nil {
+		return header{}, errors.Wrap(err, "Could not read format version")
+	}
+	if version != formatVersion {
+		return header{}, errors.New(fmt.Sprintf("Unsupported format version %d, only version %d is supported", version, formatVersion))
+	}
+
+	var fixedFields struct {
+		Flags         uint8
+		EntropyCoding uint8
+		Partitioning  uint8
+		Interpolation uint8
+		Width         uint32
+		Height        uint32
+		ChannelCount  uint8
+	}
+	err = binary.Read(reader, binary.BigEndian, &fixedFields)
+	if err != nil {
+		return header{}, errors.Wrap(err, "Could not read header")
+	}
+	if fixedFields.ChannelCount != numberOfChannels {
+		return header{}, errors.New(fmt.Sprintf("Unsupported number of channels %d, only %d channels are supported", fixedFields.ChannelCount, numberOfChannels))
+	}
+	if uint64(fixedFields.Width)*uint64(fixedFields.Height) > uint64(MaxPixels) {
+		return header{}, errors.New(fmt.Sprintf("Image size %dx%d exceeds the maximum of %d pixels", fixedFields.Width, fixedFields.Height, MaxPixels))
+	}
+
+	areaCounts := make([]uint32, fixedFields.ChannelCount)
+	err = binary.Read(reader, binary.BigEndian, areaCounts)
+	if err != nil {
+		return header{}, errors.Wrap(err, "Could not read area counts")
+	}
+
+	h := header{
+		version:       version,
+		flags:         fixedFields.Flags,
+		entropyCoding: EntropyCoding(fixedFields.EntropyCoding),
+		partitioning:  Partitioning(fixedFields.Partitioning),
+		interpolation: Interpolation(fixedFields.Interpolation),
+		width:         int(fixedFields.Width),
+		height:        int(fixedFields.Height),
+		areaCounts:    make([]int, len(areaCounts)),
+	}
+	for i, count := range areaCounts {
+		h.areaCounts[i] = int(count)
+	}
+
+	return h, nil
+}
@@ -0,0 +1,530 @@
+package encoding
+
+import "math"
+
+// integralImage contains summed-area tables of a channel, which allow to determine the sums of the values, x·value,
+// y·value, x·y·value and value² within any rectangle in constant time. From these sums, the squared error of the
+// bilinear interpolation of a rectangle can be determined without looking at its pixels (s. squaredError). Optionally,
+// the sums of the second order moments x²·value, y²·value, x²·y·value, x·y²·value and x²·y²·value are available as well,
+// which are needed for quadratic areas (s. quadraticPatch).
+//
+// Each table has a size of (width+1) x (height+1) and is stored column by column like the channels. The entry at
+// (x, y) contains the sum over all pixels left of x and above y, so the first column and row are zero.
+type integralImage struct {
+	width  int
+	height int
+	// moments[a][b] contains the sums of x^a·y^b·value for a and b up to 1. The sums are exact integers, the largest one
+	// (x·y·value) fits into 64 bits for images with billions of pixels.
+	moments    [2][2][]int64
+	squareSums []int64
+	// channel is only kept when the second order moments are available, which are determined per band (s. momentBand).
+	channel [][]uint8
+	band    *momentBand
+}
+
+// momentBand contains the summed-area tables of the second order moments for the rows from y to y+height. Tables over
+// the whole channel would need as much memory as all other tables together, but quadratic areas are small (s.
+// maxQuadraticAreaSize). Therefore, a band covers the rows of two blocks of maxQuadraticAreaSize rows, which contain
+// every quadratic area starting in the first of the blocks. The band is created when an area outside the current band
+// is requested, which rarely happens since the partitioners proceed from top to bottom.
+//
+// The coordinates of the moments are relative to the image, so the tables can be used like the ones of the whole
+// channel. The sums may overflow, which is fine since they are only used to determine the (much smaller) moments of
+// rectangles, and integer arithmetic is exact modulo 2^64 (s. rectangleMoments).
+type momentBand struct {
+	y      int
+	height int
+	// moments[a][b] contains the sums of x^a·y^b·value, the tables with a and b up to 1 are nil.
+	moments [3][3][]int64
+}
+
+// rectangleSums are the sums of the moments of the values within a rectangle. The coordinates are relative to the
+// upper-left pixel of the rectangle.
+type rectangleSums struct {
+	sum       int64
+	xSum      int64
+	ySum      int64
+	xySum     int64
+	squareSum int64
+}
+
+func newIntegralImage(channel [][]uint8, width, height int, secondOrder bool) *integralImage {
+	size := (width + 1) * (height + 1)
+
+	integral := &integralImage{
+		width:      width,
+		height:     height,
+		squareSums: make([]int64, size),
+	}
+	if secondOrder {
+		integral.channel = channel
+	}
+	for a := 0; a <= 1; a++ {
+		for b := 0; b <= 1; b++ {
+			integral.moments[a][b] = make([]int64, size)
+		}
+	}
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			value := int64(channel[x][y])
+			i := integral.index(x+1, y+1)
+			left := integral.index(x, y+1)
+			upper := integral.index(x+1, y)
+			upperLeft := integral.index(x, y)
+
+			xPowers := [2]int64{1, int64(x)}
+			yPowers := [2]int64{1, int64(y)}
+			for a := 0; a <= 1; a++ {
+				for b := 0; b <= 1; b++ {
+					table := integral.moments[a][b]
+					table[i] = xPowers[a]*yPowers[b]*value + table[left] + table[upper] - table[upperLeft]
+				}
+			}
+			integral.squareSums[i] = value*value + integral.squareSums[left] + integral.squareSums[upper] - integral.squareSums[upperLeft]
+		}
+	}
+
+	return integral
+}
+
+// newMomentBand determines the second order moments of the rows from y to y+height of the channel. The tables of the
+// given previous band are reused when it has the same height, since each band is as large as a considerable part of
+// the channel. The previous band must not be used afterwards.
+func newMomentBand(channel [][]uint8, width, y, height int, previous *momentBand) *momentBand {
+	band := &momentBand{
+		y:      y,
+		height: height,
+	}
+	if previous != nil && previous.height == height {
+		// Only the first column and row of the tables are never written, and they are zero in all bands
+		band.moments = previous.moments
+	} else {
+		for a := 0; a <= 2; a++ {
+			for b := 0; b <= 2; b++ {
+				if a == 2 || b == 2 {
+					band.moments[a][b] = make([]int64, (width+1)*(height+1))
+				}
+			}
+		}
+	}
+
+	for x := 0; x < width; x++ {
+		for row := 0; row < height; row++ {
+			value := int64(channel[x][y+row])
+			i := band.index(x+1, row+1)
+			left := band.index(x, row+1)
+			upper := band.index(x+1, row)
+			upperLeft := band.index(x, row)
+
+			xPowers := [3]int64{1, int64(x), int64(x) * int64(x)}
+			yPowers := [3]int64{1, int64(y + row), int64(y+row) * int64(y+row)}
+			for a := 0; a <= 2; a++ {
+				for b := 0; b <= 2; b++ {
+					if table := band.moments[a][b]; table != nil {
+						table[i] = xPowers[a]*yPowers[b]*value + table[left] + table[upper] - table[upperLeft]
+					}
+				}
+			}
+		}
+	}
+
+	return band
+}
+
+func (b *momentBand) index(x, row int) int {
+	return x*(b.height+1) + row
+}
+
+// rectangleSum returns the sum of the table within the rectangle, which must lie within the band.
+func (b *momentBand) rectangleSum(table []int64, x, y, width, height int) int64 {
+	row := y - b.y
+	return table[b.index(x+width, row+height)] - table[b.index(x, row+height)] - table[b.index(x+width, row)] + table[b.index(x, row)]
+}
+
+// momentBand returns the band containing the rows from y to y+height, which is created when the current band doesn't
+// contain them. The height must not exceed maxQuadraticAreaSize.
+func (i *integralImage) momentBand(y, height int) *momentBand {
+	if i.band == nil || y < i.band.y || y+height > i.band.y+i.band.height {
+		bandY := y - y%maxQuadraticAreaSize
+		bandHeight := int(math.Min(2*maxQuadraticAreaSize, float64(i.height-bandY)))
+		i.band = newMomentBand(i.channel, i.width, bandY, bandHeight, i.band)
+	}
+	return i.band
+}
+
+func (i *integralImage) index(x, y int) int {
+	return x*(i.height+1) + y
+}
+
+func (i *integralImage) rectangleSum(table []int64, x, y, width, height int) int64 {
+	return table[i.index(x+width, y+height)] - table[i.index(x, y+height)] - table[i.index(x+width, y)] + table[i.index(x, y)]
+}
+
+// rectangleSums returns the sums of the given rectangle. The moments are shifted to the upper-left pixel of the
+// rectangle, which is done on integers to avoid a loss of precision.
+func (i *integralImage) rectangleSums(x, y, width, height int) rectangleSums {
+	moments := i.rectangleMoments(x, y, width, height, 1)
+	return rectangleSums{
+		sum:       moments[0][0],
+		xSum:      moments[1][0],
+		ySum:      moments[0][1],
+		xySum:     moments[1][1],
+		squareSum: i.rectangleSum(i.squareSums, x, y, width, height),
+	}
+}
+
+// rectangleMoments returns the sums of x^a·y^b·value of the rectangle for a and b up to the given order, where x and y
+// are relative to the upper-left pixel of the rectangle. The moments relative to the image origin are shifted by
+// expanding (x-x0)^a·(y-y0)^b with the binomial theorem.
+func (i *integralImage) rectangleMoments(x, y, width, height, order int) [3][3]int64 {
+	var imageMoments [3][3]int64
+	for a := 0; a <= order; a++ {
+		for b := 0; b <= order; b++ {
+			if a <= 1 && b <= 1 {
+				imageMoments[a][b] = i.rectangleSum(i.moments[a][b], x, y, width, height)
+			} else {
+				band := i.momentBand(y, height)
+				imageMoments[a][b] = band.rectangleSum(band.moments[a][b], x, y, width, height)
+			}
+		}
+	}
+
+	// Binomial coefficients and powers of the negative offsets
+	binomials := [3][3]int64{{1, 0, 0}, {1, 1, 0}, {1, 2, 1}}
+	xOffsets := [3]int64{1, -int64(x), int64(x) * int64(x)}
+	yOffsets := [3]int64{1, -int64(y), int64(y) * int64(y)}
+
+	var moments [3][3]int64
+	for a := 0; a <= order; a++ {
+		for b := 0; b <= order; b++ {
+			for k := 0; k <= a; k++ {
+				for l := 0; l <= b; l++ {
+					moments[a][b] += binomials[a][k] * binomials[b][l] * xOffsets[a-k] * yOffsets[b-l] * imageMoments[k][l]
+				}
+			}
+		}
+	}
+	return moments
+}
+
+// squaredError returns the sum of the squared differences between the original values of the rectangle and the
+// bilinear surface through the given corner values. In mesh mode, the corner values lie one pixel beyond the right and
+// bottom edge (s. interpolate.InterpolateMesh). The interpolation truncates its values to integers, which is
+// neglected here, so the result slightly differs from the error of the actually interpolated values.
+func (i *integralImage) squaredError(x, y, width, height int, values [4]uint8, mesh bool) float64 {
+	sums := i.rectangleSums(x, y, width, height)
+	xScale, yScale := cornerScales(width, height, mesh)
+
+	// The surface is f(x, y) = a + b·x + c·y + d·x·y with x and y relative to the upper-left pixel
+	v0, v1, v2, v3 := float64(values[0]), float64(values[1]), float64(values[2]), float64(values[3])
+	a := v0
+	b := (v1 - v0) * xScale
+	c := (v2 - v0) * yScale
+	d := (v0 - v1 - v2 + v3) * xScale * yScale
+
+	// Sums of the powers of the coordinates: Σ1, Σx and Σx² (and the same for y)
+	w, h := float64(width), float64(height)
+	x1, x2 := w*(w-1)/2, (w-1)*w*(2*w-1)/6
+	y1, y2 := h*(h-1)/2, (h-1)*h*(2*h-1)/6
+
+	// Σf·value
+	productSum := a*float64(sums.sum) + b*float64(sums.xSum) + c*float64(sums.ySum) + d*float64(sums.xySum)
+
+	// Σf², the expanded square of f summed over all pixels
+	surfaceSquareSum := a*a*w*h + b*b*x2*h + c*c*w*y2 + d*d*x2*y2 +
+		2*a*b*x1*h + 2*a*c*w*y1 + 2*(a*d+b*c)*x1*y1 + 2*b*d*x2*y1 + 2*c*d*x1*y2
+
+	// Σ(value - f)² = Σvalue² - 2·Σf·value + Σf², which can't be negative apart from rounding errors
+	squaredError := float64(sums.squareSum) - 2*productSum + surfaceSquareSum
+	if squaredError < 0 {
+		return 0
+	}
+	return squaredError
+}
+
+// cornerScales returns the reciprocal distances between the corner values in x and y direction. A distance of zero,
+// i.e. an area of one column or row outside the mesh mode, results in a scale of zero.
+func cornerScales(width, height int, mesh bool) (float64, float64) {
+	xDistance, yDistance := width-1, height-1
+	if mesh {
+		xDistance, yDistance = width, height
+	}
+
+	xScale, yScale := 0.0, 0.0
+	if xDistance > 0 {
+		xScale = 1 / float64(xDistance)
+	}
+	if yDistance > 0 {
+		yScale = 1 / float64(yDistance)
+	}
+	return xScale, yScale
+}
+
+// fitValues returns the corner values, whose bilinear surface has the smallest squared error within the rectangle
+// (least squares fit). Values marked as fixed are kept, only the others are fitted. Fitted values are rounded and
+// clamped to 0-255. Only the stored corners of the given kind are fitted, all others get the value of their source
+// corner. Outside the mesh mode, the corners of an area of one column or row coincide and get the same value.
+//
+// The bilinear surface is the sum of the corner values weighted by the basis functions (1-u)(1-v), u(1-v), (1-u)v and
+// uv. Each basis function is a product of a function of u and one of v, so the matrix of the normal equations is the
+// Kronecker product of one 2x2 matrix per direction. Corners sharing a value share one unknown, whose row and column
+// of the matrix are the sums of the rows and columns of these corners.
+func (i *integralImage) fitValues(x, y, width, height int, values [4]uint8, fixed [4]bool, kind AreaKind, mesh bool) [4]uint8 {
+	xScale, yScale := cornerScales(width, height, mesh)
+	gramX := basisGramMatrix(width, xScale)
+	gramY := basisGramMatrix(height, yScale)
+
+	// Matrix of the normal equations with the corner index k = 2·y + x, summed up per source corner
+	var gram [4][4]float64
+	for k := 0; k < 4; k++ {
+		for l := 0; l < 4; l++ {
+			gram[kind.sourceCorner(k)][kind.sourceCorner(l)] += gramX[k%2][l%2] * gramY[k/2][l/2]
+		}
+	}
+
+	// Products of the basis functions with the original values
+	sums := i.rectangleSums(x, y, width, height)
+	sum, xSum, ySum := float64(sums.sum), xScale*float64(sums.xSum), yScale*float64(sums.ySum)
+	xySum := xScale * yScale * float64(sums.xySum)
+	cornerProducts := [4]float64{
+		sum - xSum - ySum + xySum,
+		xSum - xySum,
+		ySum - xySum,
+		xySum,
+	}
+	var products [4]float64
+	for k, product := range cornerProducts {
+		products[kind.sourceCorner(k)] += product
+	}
+
+	// Corners without influence on the rectangle can't be fitted and keep their value
+	var free []int
+	for k := 0; k < 4; k++ {
+		if kind.isStored(k) && !fixed[k] && gram[k][k] > 0 {
+			free = append(free, k)
+		}
+	}
+
+	// Reduced system of the free values, the fixed ones are moved to the right side
+	system := make([][]float64, len(free))
+	for row, k := range free {
+		system[row] = make([]float64, len(free)+1)
+		system[row][len(free)] = products[k]
+		for l := 0; l < 4; l++ {
+			column := indexOf(free, l)
+			if column == -1 {
+				system[row][len(free)] -= gram[k][l] * float64(values[l])
+			} else {
+				system[row][column] = gram[k][l]
+			}
+		}
+	}
+
+	result := values
+	for row, value := range solveLinearSystem(system) {
+		result[free[row]] = uint8(math.Max(0, math.Min(255, math.Round(value))))
+	}
+	for k := range result {
+		result[k] = result[kind.sourceCorner(k)]
+	}
+
+	if !mesh {
+		// The interpolation of a single column or row only uses the right or bottom values
+		if width == 1 {
+			result[1], result[3] = result[0], result[2]
+		}
+		if height == 1 {
+			result[2], result[3] = result[0], result[1]
+		}
+	}
+
+	return result
+}
+
+// fitNearestCornerValues returns the corner values, which have the smallest squared error within the rectangle when
+// each pixel gets the value of its nearest corner (s. interpolate.NearestCornerKernel). This is the mean of the pixels
+// closest to the corner, or to the corners sharing its value for the given kind. The means are rounded. Corners
+// without pixels, i.e. the left or upper ones of an area of one column or row, get the value of the right or bottom
+// corner.
+func (i *integralImage) fitNearestCornerValues(x, y, width, height int, kind AreaKind) [4]uint8 {
+	// Pixels exactly in the middle belong to the right or bottom corners
+	left, upper := width/2, height/2
+	quadrants := [4][4]int{
+		{x, y, left, upper},
+		{x + left, y, width - left, upper},
+		{x, y + upper, left, height - upper},
+		{x + left, y + upper, width - left, height - upper},
+	}
+
+	var sums [4]int64
+	var counts [4]int
+	for k, quadrant := range quadrants {
+		sums[kind.sourceCorner(k)] += i.rectangleSum(i.moments[0][0], quadrant[0], quadrant[1], quadrant[2], quadrant[3])
+		counts[kind.sourceCorner(k)] += quadrant[2] * quadrant[3]
+	}
+
+	var result [4]uint8
+	for k := range result {
+		source := kind.sourceCorner(k)
+		if counts[source] > 0 {
+			result[k] = uint8(math.Round(float64(sums[source]) / float64(counts[source])))
+		}
+	}
+
+	if width == 1 {
+		result[0], result[2] = result[1], result[3]
+	}
+	if height == 1 {
+		result[0], result[1] = result[2], result[3]
+	}
+
+	return result
+}
+
+// basisGramMatrix returns the sums of the products of the basis functions 1-u and u over the given number of pixels,
+// where u is the pixel index multiplied by the scale.
+func basisGramMatrix(size int, scale float64) [2][2]float64 {
+	n := float64(size)
+	uSum := scale * n * (n - 1) / 2
+	uSquareSum := scale * scale * (n - 1) * n * (2*n - 1) / 6
+	return [2][2]float64{
+		{n - 2*uSum + uSquareSum, uSum - uSquareSum},
+		{uSum - uSquareSum, uSquareSum},
+	}
+}
+
+// solveLinearSystem solves the system given as augmented matrix by Gaussian elimination with partial pivoting. The
+// matrix must be regular.
+func solveLinearSystem(system [][]float64) []float64 {
+	n := len(system)
+	for column := 0; column < n; column++ {
+		pivot := column
+		for row := column + 1; row < n; row++ {
+			if math.Abs(system[row][column]) > math.Abs(system[pivot][column]) {
+				pivot = row
+			}
+		}
+		system[column], system[pivot] = system[pivot], system[column]
+
+		for row := column + 1; row < n; row++ {
+			factor := system[row][column] / system[column][column]
+			for c := column; c <= n; c++ {
+				system[row][c] -= factor * system[column][c]
+			}
+		}
+	}
+
+	result := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		value := system[row][n]
+		for c := row + 1; c < n; c++ {
+			value -= system[row][c] * result[c]
+		}
+		result[row] = value / system[row][row]
+	}
+	return result
+}
+
+func indexOf(values []int, value int) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// fitQuadraticValues returns the 3x3 control values of the quadratic patch with the smallest squared error within the
+// rectangle (s. interpolate.InterpolateQuadratic) together with this error. The values are rounded and clamped to
+// 0-255, which is considered by the error. The rectangle must have at least three pixels in each direction and its
+// second order moments must be available.
+func (i *integralImage) fitQuadraticValues(x, y, width, height int) ([9]uint8, float64) {
+	gram, products, squareSum := i.quadraticPatch(x, y, width, height)
+
+	system := make([][]float64, 9)
+	for k := range system {
+		system[k] = append(gram[k][:], products[k])
+	}
+
+	var values [9]uint8
+	var fittedValues [9]float64
+	for k, value := range solveLinearSystem(system) {
+		values[k] = uint8(math.Max(0, math.Min(255, math.Round(value))))
+		fittedValues[k] = float64(values[k])
+	}
+
+	// Σ(value - f)² = Σvalue² - 2·Σf·value + Σf², which can't be negative apart from rounding errors
+	squaredError := squareSum
+	for k := range fittedValues {
+		squaredError -= 2 * fittedValues[k] * products[k]
+		for l := range fittedValues {
+			squaredError += fittedValues[k] * gram[k][l] * fittedValues[l]
+		}
+	}
+	return values, math.Max(0, squaredError)
+}
+
+// quadraticPatch returns the matrix and the right side of the normal equations of the least squares fit of a quadratic
+// patch to the rectangle together with the sum of the squared values. Like for the bilinear surface (s. fitValues),
+// the basis functions are products of one polynomial per direction, so the matrix is a Kronecker product. The control
+// value index is k = 3·y + x.
+func (i *integralImage) quadraticPatch(x, y, width, height int) ([9][9]float64, [9]float64, float64) {
+	xScale, yScale := cornerScales(width, height, false)
+	xBasis, yBasis := quadraticBasis(xScale), quadraticBasis(yScale)
+	gramX := polynomialGramMatrix(xBasis, width)
+	gramY := polynomialGramMatrix(yBasis, height)
+	moments := i.rectangleMoments(x, y, width, height, 2)
+
+	var gram [9][9]float64
+	var products [9]float64
+	for k := 0; k < 9; k++ {
+		for l := 0; l < 9; l++ {
+			gram[k][l] = gramX[k%3][l%3] * gramY[k/3][l/3]
+		}
+		for a := 0; a < 3; a++ {
+			for b := 0; b < 3; b++ {
+				products[k] += xBasis[k%3][a] * yBasis[k/3][b] * float64(moments[a][b])
+			}
+		}
+	}
+
+	return gram, products, float64(i.rectangleSum(i.squareSums, x, y, width, height))
+}
+
+// quadraticBasis returns the quadratic Lagrange polynomials through the relative positions 0, 0.5 and 1 as coefficients
+// of 1, x and x², where x is the pixel index and the relative position is x multiplied by the scale.
+func quadraticBasis(scale float64) [3][3]float64 {
+	square := scale * scale
+	return [3][3]float64{
+		{1, -3 * scale, 2 * square},
+		{0, 4 * scale, -4 * square},
+		{0, -scale, 2 * square},
+	}
+}
+
+// polynomialGramMatrix returns the sums of the products of the given polynomials (s. quadraticBasis) over the given
+// number of pixels.
+func polynomialGramMatrix(basis [3][3]float64, size int) [3][3]float64 {
+	// Sums of the powers 0 to 4 of the pixel indices 0 to n
+	n := float64(size - 1)
+	powerSums := [5]float64{
+		n + 1,
+		n * (n + 1) / 2,
+		n * (n + 1) * (2*n + 1) / 6,
+		n * n * (n + 1) * (n + 1) / 4,
+		n * (n + 1) * (2*n + 1) * (3*n*n + 3*n - 1) / 30,
+	}
+
+	var gram [3][3]float64
+	for k := range basis {
+		for l := range basis {
+			for a := 0; a < 3; a++ {
+				for b := 0; b < 3; b++ {
+					gram[k][l] += basis[k][a] * basis[l][b] * powerSums[a+b]
+				}
+			}
+		}
+	}
+	return gram
+}
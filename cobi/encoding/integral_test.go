@@ -0,0 +1,262 @@
+package encoding
+
+import (
+	"cobi/interpolate"
+	"cobi/util"
+	"math"
+	"testing"
+)
+
+func Test_integralImage_rectangleSums(t *testing.T) {
+	// 1 2 3
+	// 4 5 6
+	channel := util.TransposeArray([][]uint8{
+		{1, 2, 3},
+		{4, 5, 6},
+	})
+
+	sums := newIntegralImage(channel, 3, 2, false).rectangleSums(1, 0, 2, 2)
+
+	// Coordinates are relative to (1, 0)
+	util.AssertEqual(t, rectangleSums{
+		sum:       2 + 3 + 5 + 6,
+		xSum:      3 + 6,
+		ySum:      5 + 6,
+		xySum:     6,
+		squareSum: 4 + 9 + 25 + 36,
+	}, sums)
+}
+
+func Test_integralImage_squaredError(t *testing.T) {
+	img := newTestImage(40, 30)
+	integral := newIntegralImage(img.B, img.Width, img.Height, true)
+
+	for _, mesh := range []bool{false, true} {
+		for _, area := range []EncodedArea{
+			{X: 0, Y: 0, W: 40, H: 30, Values: [4]uint8{10, 200, 30, 0}},
+			{X: 25, Y: 17, W: 9, H: 6, Values: [4]uint8{100, 120, 90, 130}},
+			{X: 3, Y: 4, W: 1, H: 5, Values: [4]uint8{7, 7, 80, 80}},
+			{X: 39, Y: 29, W: 1, H: 1, Values: [4]uint8{50, 50, 50, 50}},
+		} {
+			expected := bilinearSquaredError(img.B, area, mesh)
+			actual := integral.squaredError(area.X, area.Y, area.W, area.H, area.Values, mesh)
+			util.AssertAlmostEqual(t, expected, actual, 1e-6*expected+1e-6)
+		}
+	}
+}
+
+func Test_integralImage_fitValues_noisyCorner(t *testing.T) {
+	// Horizontal gradient from 10 to 40 with a noisy upper-left pixel
+	channel := util.TransposeArray([][]uint8{
+		{90, 20, 30, 40},
+		{10, 20, 30, 40},
+		{10, 20, 30, 40},
+		{10, 20, 30, 40},
+	})
+	integral := newIntegralImage(channel, 4, 4, true)
+
+	values := integral.fitValues(0, 0, 4, 4, [4]uint8{90, 40, 10, 40}, [4]bool{}, BilinearArea, false)
+
+	// The noise is spread over the whole area instead of skewing the gradient
+	util.AssertEqual(t, [4]uint8{49, 29, 0, 43}, values)
+	util.AssertTrue(t, integral.squaredError(0, 0, 4, 4, values, false) < integral.squaredError(0, 0, 4, 4, [4]uint8{90, 40, 10, 40}, false))
+}
+
+func Test_integralImage_fitValues_bilinearSurface(t *testing.T) {
+	surface := EncodedArea{X: 0, Y: 0, W: 7, H: 5, Values: [4]uint8{10, 70, 130, 250}}
+	channel := surface.GetInterpolatedArea(interpolate.BilinearKernel{})
+	integral := newIntegralImage(channel, 7, 5, true)
+
+	// Starting from wrong values, the surface is recovered apart from the truncation of the interpolation
+	values := integral.fitValues(0, 0, 7, 5, [4]uint8{0, 0, 0, 0}, [4]bool{}, BilinearArea, false)
+	for i := range values {
+		util.AssertAlmostEqual(t, float64(surface.Values[i]), float64(values[i]), 1)
+	}
+}
+
+func Test_integralImage_fitValues_reducesError(t *testing.T) {
+	img := newTestImage(40, 30)
+	integral := newIntegralImage(img.B, img.Width, img.Height, true)
+
+	for _, mesh := range []bool{false, true} {
+		for _, fixed := range [][4]bool{{}, {true, false, true, false}} {
+			for _, area := range []EncodedArea{
+				{X: 0, Y: 0, W: 40, H: 30, Values: [4]uint8{10, 200, 30, 0}},
+				{X: 25, Y: 17, W: 9, H: 6, Values: [4]uint8{100, 120, 90, 130}},
+				{X: 3, Y: 4, W: 2, H: 5, Values: [4]uint8{7, 7, 80, 80}},
+			} {
+				fittedArea := area
+				fittedArea.Values = integral.fitValues(area.X, area.Y, area.W, area.H, area.Values, fixed, BilinearArea, mesh)
+
+				for i := range area.Values {
+					if fixed[i] {
+						util.AssertEqual(t, area.Values[i], fittedArea.Values[i])
+					}
+				}
+				util.AssertTrue(t, bilinearSquaredError(img.B, fittedArea, mesh) <= bilinearSquaredError(img.B, area, mesh))
+			}
+		}
+	}
+}
+
+func Test_integralImage_fitValues_fixedAndSingleColumn(t *testing.T) {
+	channel := util.TransposeArray([][]uint8{
+		{10, 20},
+		{30, 40},
+		{50, 60},
+	})
+	integral := newIntegralImage(channel, 2, 3, true)
+
+	// Fixed values are kept
+	values := integral.fitValues(0, 0, 2, 3, [4]uint8{1, 2, 3, 4}, [4]bool{true, true, true, true}, BilinearArea, false)
+	util.AssertEqual(t, [4]uint8{1, 2, 3, 4}, values)
+
+	// The corners of a single column coincide
+	values = integral.fitValues(1, 0, 1, 3, [4]uint8{20, 20, 60, 60}, [4]bool{}, BilinearArea, false)
+	util.AssertEqual(t, [4]uint8{20, 20, 60, 60}, values)
+
+	// In mesh mode, the right vertices of a single column have no influence and keep their value
+	values = integral.fitValues(1, 0, 1, 2, [4]uint8{0, 7, 0, 8}, [4]bool{}, BilinearArea, true)
+	util.AssertEqual(t, [4]uint8{20, 7, 60, 8}, values)
+}
+
+func Test_integralImage_fitNearestCornerValues(t *testing.T) {
+	// The left quadrants have two columns, the right ones three. The upper quadrants have one row, the bottom ones two.
+	channel := util.TransposeArray([][]uint8{
+		{10, 20, 1, 2, 3},
+		{30, 40, 200, 200, 200},
+		{50, 60, 100, 100, 100},
+	})
+	integral := newIntegralImage(channel, 5, 3, false)
+
+	util.AssertEqual(t, [4]uint8{15, 2, 45, 150}, integral.fitNearestCornerValues(0, 0, 5, 3, BilinearArea))
+	util.AssertEqual(t, [4]uint8{35, 101, 35, 101}, integral.fitNearestCornerValues(0, 0, 5, 3, HorizontalArea))
+	util.AssertEqual(t, [4]uint8{7, 7, 108, 108}, integral.fitNearestCornerValues(0, 0, 5, 3, VerticalArea))
+
+	// A single column only has right corners
+	util.AssertEqual(t, [4]uint8{2, 2, 150, 150}, integral.fitNearestCornerValues(3, 0, 1, 3, BilinearArea))
+}
+
+func Test_integralImage_rectangleMoments(t *testing.T) {
+	img := newTestImage(40, 30)
+	integral := newIntegralImage(img.B, img.Width, img.Height, true)
+
+	moments := integral.rectangleMoments(25, 17, 9, 6, 2)
+
+	util.AssertEqual(t, expectedMoments(img.B, 25, 17, 9, 6), moments)
+}
+
+func Test_integralImage_rectangleMoments_bands(t *testing.T) {
+	img := newTestImage(5, 3*maxQuadraticAreaSize)
+	integral := newIntegralImage(img.B, img.Width, img.Height, true)
+
+	// The first band is reused as long as it contains the rectangles. Each other band starts at the block of the
+	// rectangle, and the last one is shorter.
+	rectangles := [][4]int{
+		{1, 400, 4, maxQuadraticAreaSize},
+		{0, maxQuadraticAreaSize + 10, 5, 300},
+		{0, 2*maxQuadraticAreaSize - 100, 5, 300},
+		{2, 10, 3, 100},
+		{0, 2*maxQuadraticAreaSize + 100, 5, maxQuadraticAreaSize - 100},
+	}
+	expectedBands := [][2]int{
+		{0, 2 * maxQuadraticAreaSize},
+		{0, 2 * maxQuadraticAreaSize},
+		{maxQuadraticAreaSize, 2 * maxQuadraticAreaSize},
+		{0, 2 * maxQuadraticAreaSize},
+		{2 * maxQuadraticAreaSize, maxQuadraticAreaSize},
+	}
+	for k, r := range rectangles {
+		moments := integral.rectangleMoments(r[0], r[1], r[2], r[3], 2)
+
+		util.AssertEqual(t, expectedMoments(img.B, r[0], r[1], r[2], r[3]), moments)
+		util.AssertEqual(t, expectedBands[k], [2]int{integral.band.y, integral.band.height})
+	}
+}
+
+// expectedMoments determines the second order moments of the rectangle pixel by pixel (s. rectangleMoments).
+func expectedMoments(channel [][]uint8, x, y, width, height int) [3][3]int64 {
+	var moments [3][3]int64
+	for a := 0; a <= 2; a++ {
+		for b := 0; b <= 2; b++ {
+			for i := 0; i < width; i++ {
+				for j := 0; j < height; j++ {
+					moments[a][b] += int64(math.Pow(float64(i), float64(a))*math.Pow(float64(j), float64(b))) * int64(channel[x+i][y+j])
+				}
+			}
+		}
+	}
+	return moments
+}
+
+func Test_integralImage_fitQuadraticValues(t *testing.T) {
+	patch := [9]uint8{
+		10, 120, 30,
+		90, 200, 80,
+		40, 100, 20,
+	}
+	channel := interpolate.InterpolateQuadratic(9, 7, patch)
+	integral := newIntegralImage(channel, 9, 7, true)
+
+	// The patch is recovered apart from the rounding of the interpolation
+	values, squaredError := integral.fitQuadraticValues(0, 0, 9, 7)
+	for i := range values {
+		util.AssertAlmostEqual(t, float64(patch[i]), float64(values[i]), 1)
+	}
+	util.AssertTrue(t, squaredError < 0.5*9*7)
+
+	// The error is the one of the (not rounded) patch
+	img := newTestImage(40, 30)
+	integral = newIntegralImage(img.B, img.Width, img.Height, true)
+	values, squaredError = integral.fitQuadraticValues(25, 17, 9, 6)
+	expected := quadraticSquaredError(img.B, EncodedArea{X: 25, Y: 17, W: 9, H: 6}, values)
+	util.AssertAlmostEqual(t, expected, squaredError, 1e-6*expected)
+}
+
+// quadraticSquaredError determines the squared error of the exact (not rounded) quadratic patch pixel by pixel.
+func quadraticSquaredError(channel [][]uint8, area EncodedArea, patch [9]uint8) float64 {
+	lagrange := func(u float64) [3]float64 {
+		return [3]float64{2*u*u - 3*u + 1, 4*u - 4*u*u, 2*u*u - u}
+	}
+
+	squaredError := 0.0
+	for x := 0; x < area.W; x++ {
+		for y := 0; y < area.H; y++ {
+			xWeights := lagrange(float64(x) / float64(area.W-1))
+			yWeights := lagrange(float64(y) / float64(area.H-1))
+			value := 0.0
+			for i := 0; i < 9; i++ {
+				value += xWeights[i%3] * yWeights[i/3] * float64(patch[i])
+			}
+			diff := float64(channel[area.X+x][area.Y+y]) - value
+			squaredError += diff * diff
+		}
+	}
+	return squaredError
+}
+
+// bilinearSquaredError determines the squared error of the exact (not truncated) bilinear surface pixel by pixel.
+func bilinearSquaredError(channel [][]uint8, area EncodedArea, mesh bool) float64 {
+	xDistance, yDistance := float64(area.W-1), float64(area.H-1)
+	if mesh {
+		xDistance, yDistance = float64(area.W), float64(area.H)
+	}
+
+	squaredError := 0.0
+	for x := 0; x < area.W; x++ {
+		for y := 0; y < area.H; y++ {
+			u, v := 0.0, 0.0
+			if xDistance > 0 {
+				u = float64(x) / xDistance
+			}
+			if yDistance > 0 {
+				v = float64(y) / yDistance
+			}
+			value := float64(area.Values[0])*(1-u)*(1-v) + float64(area.Values[1])*u*(1-v) +
+				float64(area.Values[2])*(1-u)*v + float64(area.Values[3])*u*v
+			diff := float64(channel[area.X+x][area.Y+y]) - value
+			squaredError += diff * diff
+		}
+	}
+	return squaredError
+}
@@ -0,0 +1,67 @@
+package encoding
+
+import (
+	"cobi/interpolate"
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// Interpolation determines the kernel, which fills the bilinear, constant, horizontal and vertical areas from their
+// corner values (s. interpolate.Kernel). It trades the blockiness of the areas against their smoothness.
+type Interpolation uint8
+
+const (
+	// BilinearInterpolation interpolates linearly between the corners (s. interpolate.BilinearKernel).
+	BilinearInterpolation Interpolation = iota
+	// NearestCornerInterpolation gives each pixel the value of its nearest corner (s. interpolate.NearestCornerKernel).
+	NearestCornerInterpolation
+	// SmoothstepInterpolation eases in and out of the corners (s. interpolate.SmoothstepKernel).
+	SmoothstepInterpolation
+)
+
+// Interpolations contains all available interpolations by their name.
+var Interpolations = map[string]Interpolation{
+	"bilinear":   BilinearInterpolation,
+	"nearest":    NearestCornerInterpolation,
+	"smoothstep": SmoothstepInterpolation,
+}
+
+// kernels contains the kernel of each interpolation.
+var kernels = map[Interpolation]interpolate.Kernel{
+	BilinearInterpolation:      interpolate.BilinearKernel{},
+	NearestCornerInterpolation: interpolate.NearestCornerKernel{},
+	SmoothstepInterpolation:    interpolate.SmoothstepKernel{},
+}
+
+// InterpolationNames returns the sorted names of all available interpolations.
+func InterpolationNames() []string {
+	var names []string
+	for name := range Interpolations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetInterpolation returns the interpolation with the given name (s. Interpolations).
+func GetInterpolation(name string) (Interpolation, error) {
+	interpolation, ok := Interpolations[name]
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("Unknown interpolation %s, available are: %v", name, InterpolationNames()))
+	}
+	return interpolation, nil
+}
+
+// kernel returns the kernel of the interpolation. In mesh mode, only the bilinear interpolation is supported, since
+// the values of T-junctions are derived from the linear edges of the areas (s. edgeValue).
+func (i Interpolation) kernel(mesh bool) (interpolate.Kernel, error) {
+	kernel, ok := kernels[i]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unsupported interpolation %d", i))
+	}
+	if mesh && i != BilinearInterpolation {
+		return nil, errors.New(fmt.Sprintf("Interpolation %d can't be combined with the mesh mode, only the bilinear interpolation can", i))
+	}
+	return kernel, nil
+}
@@ -0,0 +1,115 @@
+package encoding
+
+import (
+	"bytes"
+	"cobi/util"
+	"testing"
+)
+
+func Test_interpolations(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	for _, name := range InterpolationNames() {
+		interpolation, err := GetInterpolation(name)
+		util.AssertNil(t, err)
+
+		encodedImage, err := EncodeImage(*img, &Options{Quality: 50, Interpolation: interpolation})
+		util.AssertNil(t, err)
+		util.AssertEqual(t, interpolation, encodedImage.Interpolation)
+		expectedImage, err := DecodeImage(encodedImage)
+		util.AssertNil(t, err)
+
+		buffer := &bytes.Buffer{}
+		err = WriteImage(buffer, encodedImage)
+		util.AssertNil(t, err)
+		actual, err := ReadImage(buffer)
+		util.AssertNil(t, err)
+		util.AssertEqual(t, interpolation, actual.Interpolation)
+		assertAreasEqual(t, encodedImage.Areas, actual.Areas)
+
+		actualImage, err := DecodeImage(actual)
+		util.AssertNil(t, err)
+		util.AssertArrayEqual(t, expectedImage.R, actualImage.R)
+		util.AssertArrayEqual(t, expectedImage.G, actualImage.G)
+		util.AssertArrayEqual(t, expectedImage.B, actualImage.B)
+		util.AssertArrayEqual(t, expectedImage.A, actualImage.A)
+	}
+}
+
+func Test_interpolations_lossless(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	for _, interpolation := range Interpolations {
+		encodedImage, err := EncodeImage(*img, &Options{Quality: 20, Lossless: true, Interpolation: interpolation})
+		util.AssertNil(t, err)
+		decodedImage, err := DecodeImage(encodedImage)
+		util.AssertNil(t, err)
+
+		// The residuals are determined with the same kernel as used by the decoder
+		util.AssertArrayEqual(t, img.R, decodedImage.R)
+		util.AssertArrayEqual(t, img.G, decodedImage.G)
+		util.AssertArrayEqual(t, img.B, decodedImage.B)
+		util.AssertArrayEqual(t, img.A, decodedImage.A)
+	}
+}
+
+func Test_interpolation_nearestCornerResultsInBlocks(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	encodedImage, err := EncodeImage(*img, &Options{Quality: 50, Interpolation: NearestCornerInterpolation})
+	util.AssertNil(t, err)
+	decodedImage, err := DecodeImage(encodedImage)
+	util.AssertNil(t, err)
+
+	// Each pixel of a bilinear area has the value of one of its corners
+	for _, area := range encodedImage.Areas[0] {
+		if area.Kind != BilinearArea {
+			continue
+		}
+		for x := area.X; x < area.X+area.W; x++ {
+			for y := area.Y; y < area.Y+area.H; y++ {
+				value := decodedImage.R[x][y]
+				util.AssertTrue(t, value == area.Values[0] || value == area.Values[1] || value == area.Values[2] || value == area.Values[3])
+			}
+		}
+	}
+}
+
+func Test_interpolation_mesh(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	_, err := EncodeImage(*img, &Options{Quality: 50, Mesh: true, Interpolation: SmoothstepInterpolation})
+	util.AssertError(t, "Interpolation 2 can't be combined with the mesh mode, only the bilinear interpolation can", err)
+
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 4, H: 2, Values: [4]uint8{3, 3, 3, 3}},
+	}
+	err = WriteImage(&bytes.Buffer{}, &EncodedImage{Width: 4, Height: 2, Areas: [4][]EncodedArea{areas, areas, areas, areas}, Mesh: true, Interpolation: NearestCornerInterpolation})
+	util.AssertError(t, "Interpolation 1 can't be combined with the mesh mode, only the bilinear interpolation can", err)
+}
+
+func Test_readImage_unsupportedInterpolation(t *testing.T) {
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 4, H: 2, Values: [4]uint8{3, 3, 3, 3}, Kind: ConstantArea},
+	}
+	buffer := &bytes.Buffer{}
+	err := WriteImage(buffer, &EncodedImage{Width: 4, Height: 2, Areas: [4][]EncodedArea{areas, areas, areas, areas}, Interpolation: SmoothstepInterpolation})
+	util.AssertNil(t, err)
+
+	// The interpolation follows the magic bytes, version, flags, entropy coding and partitioning
+	data := buffer.Bytes()
+	util.AssertEqual(t, uint8(SmoothstepInterpolation), data[8])
+	data[8] = 42
+
+	_, err = ReadImage(bytes.NewReader(data))
+	util.AssertError(t, "Unsupported interpolation 42", err)
+}
+
+func Test_getInterpolation(t *testing.T) {
+	interpolation, err := GetInterpolation("smoothstep")
+	util.AssertNil(t, err)
+	util.AssertEqual(t, SmoothstepInterpolation, interpolation)
+
+	_, err = GetInterpolation("foo")
+	util.AssertError(t, "Unknown interpolation foo, available are: [bilinear nearest smoothstep]", err)
+}
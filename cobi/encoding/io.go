@@ -1,27 +1,347 @@
 package encoding
 
 import (
+	"bufio"
+	"bytes"
+	"cobi/interpolate"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
 	"os"
 )
 
-func Write(filePath string, areas [4][]EncodedArea) error {
-	var data []uint8
+// WriteImage writes the encoded image to the given writer. The data starts with a header (s. header type) followed by
+// the areas of the R, G, B and A channel and, for lossless images, the residuals (s. writeResiduals). The areas are
+// stored as symbol stream (s. serialize) using the entropy coding of the encoded image.
+func WriteImage(w io.Writer, encodedImage *EncodedImage) error {
+	kernel, err := encodedImage.Interpolation.kernel(encodedImage.Mesh)
+	if err != nil {
+		return err
+	}
+
+	buffer := &bytes.Buffer{}
+	newHeader(encodedImage).write(buffer)
+
+	symbols, err := newSymbolWriter(encodedImage.EntropyCoding, buffer)
+	if err != nil {
+		return err
+	}
+
+	for i, channel := range encodedImage.Areas {
+		values := newValueCoder(encodedImage.Width, encodedImage.Height, encodedImage.Mesh, kernel)
+
+		switch encodedImage.Partitioning {
+		case GreedyPartitioning:
+			err = writeGreedyAreas(channel, encodedImage.Width, encodedImage.Height, symbols, values)
+		case QuadtreePartitioning:
+			err = writeQuadtreeAreas(channel, encodedImage.Width, encodedImage.Height, symbols, values)
+		default:
+			err = errors.New(fmt.Sprintf("Unsupported partitioning %d", encodedImage.Partitioning))
+		}
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Areas of channel %d cannot be stored", i))
+		}
+	}
+
+	err = symbols.close()
+	if err != nil {
+		return errors.Wrap(err, "Could not write areas")
+	}
+
+	if encodedImage.IsLossless() {
+		err = writeResiduals(buffer, encodedImage.Residuals)
+		if err != nil {
+			return errors.Wrap(err, "Could not write residuals")
+		}
+	}
+
+	_, err = buffer.WriteTo(w)
+	return err
+}
+
+// ReadImage reads the data written by WriteImage from the given reader. No data beyond the encoded image is consumed
+// when the reader is an io.ByteReader, otherwise the reader is buffered and might be read further.
+func ReadImage(r io.Reader) (*EncodedImage, error) {
+	reader := asByteReader(r)
+
+	h, err := readHeader(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read header")
+	}
+
+	encodedImage := &EncodedImage{
+		Width:         h.width,
+		Height:        h.height,
+		EntropyCoding: h.entropyCoding,
+		Mesh:          h.hasFlag(flagMesh),
+		Partitioning:  h.partitioning,
+		Interpolation: h.interpolation,
+	}
+
+	kernel, err := encodedImage.Interpolation.kernel(encodedImage.Mesh)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols, err := newSymbolReader(h.entropyCoding, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range encodedImage.Areas {
+		if h.areaCounts[i] > h.width*h.height {
+			return nil, errors.New(fmt.Sprintf("Channel %d contains %d areas but the image only has %d pixels", i, h.areaCounts[i], h.width*h.height))
+		}
+
+		values := newValueCoder(h.width, h.height, encodedImage.Mesh, kernel)
+
+		var areas []EncodedArea
+		switch h.partitioning {
+		case GreedyPartitioning:
+			areas, err = readGreedyAreas(h.areaCounts[i], h.width, h.height, symbols, values)
+		case QuadtreePartitioning:
+			areas, err = readQuadtreeAreas(h.areaCounts[i], h.width, h.height, symbols, values)
+		default:
+			err = errors.New(fmt.Sprintf("Unsupported partitioning %d", h.partitioning))
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Invalid areas in channel %d", i))
+		}
+		encodedImage.Areas[i] = areas
+	}
+
+	if h.hasFlag(flagLossless) {
+		encodedImage.Residuals, err = readResiduals(reader, h.width, h.height)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not read residuals")
+		}
+	}
+
+	return encodedImage, nil
+}
+
+// Write stores the encoded image in the given file (s. WriteImage).
+func Write(filePath string, encodedImage *EncodedImage) error {
+	buffer := &bytes.Buffer{}
+	err := WriteImage(buffer, encodedImage)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, buffer.Bytes(), 0644)
+}
+
+// Read reads the encoded image from the given file (s. ReadImage).
+func Read(filePath string) (*EncodedImage, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read input file %s", filePath))
+	}
+
+	reader := bytes.NewReader(data)
+	encodedImage, err := ReadImage(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read file %s", filePath))
+	}
+
+	if reader.Len() != 0 {
+		return nil, errors.New(fmt.Sprintf("Unexpected %d trailing bytes in file %s", reader.Len(), filePath))
+	}
+
+	return encodedImage, nil
+}
+
+// writeResiduals writes the residuals of all channels as one deflate compressed block, which is prefixed by its length
+// (4 bytes, big-endian). Within a channel, the residuals are stored row by row.
+func writeResiduals(buffer *bytes.Buffer, residuals [4][][]uint8) error {
+	compressedData := &bytes.Buffer{}
+	compressor, err := flate.NewWriter(compressedData, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	for _, residual := range residuals {
+		row := make([]uint8, len(residual))
+		for y := 0; len(residual) > 0 && y < len(residual[0]); y++ {
+			for x := range residual {
+				row[x] = residual[x][y]
+			}
+			_, err = compressor.Write(row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = compressor.Close()
+	if err != nil {
+		return err
+	}
+
+	buffer.Write(binary.BigEndian.AppendUint32(nil, uint32(compressedData.Len())))
+	_, err = compressedData.WriteTo(buffer)
+	return err
+}
+
+// readResiduals reads the residuals written by writeResiduals. The decompressed data is buffered as it arrives, so that
+// a truncated block doesn't cause allocations of the whole image size.
+func readResiduals(reader io.Reader, width, height int) ([4][][]uint8, error) {
+	var compressedLength uint32
+	err := binary.Read(reader, binary.BigEndian, &compressedLength)
+	if err != nil {
+		return [4][][]uint8{}, err
+	}
+
+	compressedData := &bytes.Buffer{}
+	_, err = io.CopyN(compressedData, reader, int64(compressedLength))
+	if err != nil {
+		return [4][][]uint8{}, err
+	}
+
+	decompressor := flate.NewReader(compressedData)
+	defer decompressor.Close()
+
+	var residuals [4][][]uint8
+	for i := range residuals {
+		channelData := &bytes.Buffer{}
+		_, err = io.CopyN(channelData, decompressor, int64(width*height))
+		if err != nil {
+			return [4][][]uint8{}, errors.Wrap(err, fmt.Sprintf("Could not decompress row %d of channel %d", channelData.Len()/width, i))
+		}
+
+		data := channelData.Bytes()
+		residuals[i] = make([][]uint8, width)
+		for x := range residuals[i] {
+			residuals[i][x] = make([]uint8, height)
+			for y := range residuals[i][x] {
+				residuals[i][x][y] = data[y*width+x]
+			}
+		}
+	}
+
+	return residuals, nil
+}
+
+// byteReader is an io.Reader which can also read single bytes, like bufio.Reader and bytes.Reader.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func asByteReader(r io.Reader) byteReader {
+	if reader, ok := r.(byteReader); ok {
+		return reader
+	}
+	return bufio.NewReader(r)
+}
+
+// ensureEncodingOrder returns an error when the positions of the given areas differ from the positions the decoder
+// would restore. Only areas in the order produced by the encoder can be stored without their positions.
+func ensureEncodingOrder(areas []EncodedArea, width, height int) error {
+	restoredAreas := make([]EncodedArea, len(areas))
+	copy(restoredAreas, areas)
+
+	err := restoreAreaPositions(restoredAreas, width, height)
+	if err != nil {
+		return err
+	}
 
-	for _, channel := range areas {
-		for _, area := range channel {
-			data = append(data, serialize(area)...)
+	for i := range areas {
+		if areas[i].X != restoredAreas[i].X || areas[i].Y != restoredAreas[i].Y {
+			return errors.New(fmt.Sprintf("Area %d is at (%d, %d) but would be restored at (%d, %d)", i, areas[i].X, areas[i].Y, restoredAreas[i].X, restoredAreas[i].Y))
 		}
 	}
 
-	return os.WriteFile(filePath, data, 0644)
+	return nil
 }
 
-func serialize(area EncodedArea) []uint8 {
-	return []byte{
-		area.Values[0],
-		area.Values[1],
-		area.Values[2],
-		area.Values[3],
-		area.W,
+// valueCoder stores the values of the areas of a channel as residuals in the symbol stream. Encoder and decoder make
+// the same predictions as long as they process the areas in the same order (s. valuePredictor and vertexTable).
+type valueCoder interface {
+	writeValues(area EncodedArea, symbols symbolWriter) error
+	readValues(area *EncodedArea, symbols symbolReader) error
+}
+
+// newValueCoder returns the value coder of a channel, which is a vertexTable in mesh mode and a valuePredictor
+// otherwise.
+func newValueCoder(width, height int, mesh bool, kernel interpolate.Kernel) valueCoder {
+	if mesh {
+		return newVertexTable(width, height)
+	}
+	return newValuePredictor(width, height, kernel)
+}
+
+// writeGreedyAreas writes the areas of a channel, which must be in the order of the greedy partitioning
+// (s. ensureEncodingOrder), one after another (s. serialize).
+func writeGreedyAreas(areas []EncodedArea, width, height int, symbols symbolWriter, values valueCoder) error {
+	err := ensureEncodingOrder(areas, width, height)
+	if err != nil {
+		return err
+	}
+
+	for i, area := range areas {
+		err = serialize(area, symbols, values)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Could not write area %d", i))
+		}
+	}
+	return nil
+}
+
+// readGreedyAreas reads the given number of areas written by writeGreedyAreas and ensures that they cover the whole
+// channel. The count is not trusted, so the areas are collected as they are read instead of allocating all of them at
+// once.
+func readGreedyAreas(count, width, height int, symbols symbolReader, values valueCoder) ([]EncodedArea, error) {
+	coverage := newCoverageMap(width, height)
+	var areas []EncodedArea
+	for i := 0; i < count; i++ {
+		area, err := deserialize(symbols, coverage, values)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Could not read area %d", i))
+		}
+		areas = append(areas, area)
+	}
+
+	err := coverage.ensureComplete()
+	if err != nil {
+		return nil, err
+	}
+	return areas, nil
+}
+
+// serialize writes the symbols of the area: width, height and the residuals of its values (s. valueCoder).
+func serialize(area EncodedArea, symbols symbolWriter, values valueCoder) error {
+	symbols.writeSize(area.W)
+	symbols.writeSize(area.H)
+	return values.writeValues(area, symbols)
+}
+
+// deserialize reads the symbols written by serialize. The position of an area is not stored, it is determined by
+// replaying the walk of the encoder over the image (s. restoreAreaPositions).
+func deserialize(symbols symbolReader, coverage *coverageMap, values valueCoder) (EncodedArea, error) {
+	var err error
+	area := EncodedArea{}
+
+	area.W, err = symbols.readSize()
+	if err != nil {
+		return EncodedArea{}, err
 	}
+	area.H, err = symbols.readSize()
+	if err != nil {
+		return EncodedArea{}, err
+	}
+
+	err = coverage.place(&area)
+	if err != nil {
+		return EncodedArea{}, err
+	}
+
+	err = values.readValues(&area, symbols)
+	if err != nil {
+		return EncodedArea{}, err
+	}
+
+	return area, nil
 }
@@ -0,0 +1,235 @@
+package encoding
+
+import (
+	"bytes"
+	"cobi/util"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func Test_writeAndRead(t *testing.T) {
+	areas := [4][]EncodedArea{
+		{
+			{X: 0, Y: 0, W: 5, H: 5, Values: [4]uint8{0, 10, 5, 20}},
+			{X: 5, Y: 0, W: 3, H: 5, Values: [4]uint8{12, 14, 18, 10}},
+		},
+		{
+			{X: 0, Y: 0, W: 6, H: 5, Values: [4]uint8{1, 2, 3, 4}},
+			{X: 6, Y: 0, W: 2, H: 5, Kind: RawArea, Pixels: [][]uint8{{9, 200, 3, 4, 5}, {0, 255, 17, 17, 1}}},
+		},
+		{
+			{X: 0, Y: 0, W: 8, H: 3, Values: [4]uint8{255, 0, 255, 0}, Kind: HorizontalArea},
+			{X: 0, Y: 3, W: 8, H: 2, Values: [4]uint8{7, 7, 7, 7}, Kind: ConstantArea},
+		},
+		{
+			{X: 0, Y: 0, W: 8, H: 2, Values: [4]uint8{255, 255, 9, 9}, Kind: VerticalArea},
+			{X: 0, Y: 2, W: 8, H: 3, Values: [4]uint8{3, 40, 90, 0}, Midpoints: [5]uint8{200, 17, 255, 1, 64}, Kind: QuadraticArea},
+		},
+	}
+	filePath := filepath.Join(t.TempDir(), "test.cobi")
+
+	err := Write(filePath, &EncodedImage{Width: 8, Height: 5, Areas: areas})
+	util.AssertNil(t, err)
+
+	actual, err := Read(filePath)
+	util.AssertNil(t, err)
+	util.AssertEqual(t, 8, actual.Width)
+	util.AssertEqual(t, 5, actual.Height)
+	util.AssertFalse(t, actual.IsLossless())
+	assertAreasEqual(t, areas, actual.Areas)
+}
+
+func Test_writeAndRead_lossless(t *testing.T) {
+	img := newTestImage(40, 30)
+	encodedImage, err := EncodeImage(*img, &Options{Quality: 20, Lossless: true})
+	util.AssertNil(t, err)
+	filePath := filepath.Join(t.TempDir(), "test.cobi")
+
+	err = Write(filePath, encodedImage)
+	util.AssertNil(t, err)
+
+	actual, err := Read(filePath)
+	util.AssertNil(t, err)
+	util.AssertTrue(t, actual.IsLossless())
+	assertAreasEqual(t, encodedImage.Areas, actual.Areas)
+	for i := range encodedImage.Residuals {
+		util.AssertArrayEqual(t, encodedImage.Residuals[i], actual.Residuals[i])
+	}
+}
+
+func assertAreasEqual(t *testing.T, expected [4][]EncodedArea, actual [4][]EncodedArea) {
+	for i := range expected {
+		util.AssertEqual(t, len(expected[i]), len(actual[i]))
+		for j := range expected[i] {
+			util.AssertDeepEqual(t, expected[i][j], actual[i][j])
+		}
+	}
+}
+
+func Test_readHeader(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	newHeader(&EncodedImage{
+		Width:         8,
+		Height:        5,
+		Areas:         [4][]EncodedArea{make([]EncodedArea, 2), make([]EncodedArea, 1), nil, make([]EncodedArea, 3)},
+		Interpolation: SmoothstepInterpolation,
+	}).write(buffer)
+
+	h, err := readHeader(buffer)
+
+	util.AssertNil(t, err)
+	util.AssertEqual(t, formatVersion, h.version)
+	util.AssertEqual(t, 8, h.width)
+	util.AssertEqual(t, 5, h.height)
+	util.AssertEqual(t, SmoothstepInterpolation, h.interpolation)
+	util.AssertEqual(t, 4, len(h.areaCounts))
+	util.AssertEqual(t, 2, h.areaCounts[0])
+	util.AssertEqual(t, 1, h.areaCounts[1])
+	util.AssertEqual(t, 0, h.areaCounts[2])
+	util.AssertEqual(t, 3, h.areaCounts[3])
+}
+
+func Test_readHeader_invalidMagicBytes(t *testing.T) {
+	_, err := readHeader(bytes.NewReader([]byte("\x89PNG\r\n\x1a\n")))
+
+	util.AssertError(t, "Invalid magic bytes \"\\x89PNG\", this is not a cobi file", err)
+}
+
+func Test_readHeader_unsupportedVersion(t *testing.T) {
+	_, err := readHeader(bytes.NewReader([]byte(Magic + "\xff")))
+
+	util.AssertError(t, fmt.Sprintf("Unsupported format version 255, only version %d is supported", formatVersion), err)
+}
+
+func Test_readImage_oversizedHeader(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	header{
+		version:       formatVersion,
+		entropyCoding: NoEntropyCoding,
+		width:         1 << 16,
+		height:        1 << 16,
+		areaCounts:    []int{1 << 31, 1 << 31, 1 << 31, 1 << 31},
+	}.write(buffer)
+
+	_, err := ReadImage(bytes.NewReader(buffer.Bytes()))
+	util.AssertError(t, "Could not read header: Image size 65536x65536 exceeds the maximum of 134217728 pixels", err)
+
+	_, err = DecodeConfig(bytes.NewReader(buffer.Bytes()))
+	util.AssertError(t, "Image size 65536x65536 exceeds the maximum of 134217728 pixels", err)
+}
+
+func Test_readImage_truncatedData(t *testing.T) {
+	// The header claims as many areas as pixels but no areas follow
+	buffer := &bytes.Buffer{}
+	header{
+		version:       formatVersion,
+		entropyCoding: NoEntropyCoding,
+		width:         4000,
+		height:        4000,
+		areaCounts:    []int{4000 * 4000, 1, 1, 1},
+	}.write(buffer)
+
+	_, err := ReadImage(bytes.NewReader(buffer.Bytes()))
+	util.AssertError(t, "Invalid areas in channel 0: Could not read area 0: EOF", err)
+
+	// Residuals of a lossless image missing their end
+	buffer = &bytes.Buffer{}
+	encodedImage, err := EncodeImage(*newTestImage(40, 30), &Options{Quality: 0, Lossless: true})
+	util.AssertNil(t, err)
+	err = WriteImage(buffer, encodedImage)
+	util.AssertNil(t, err)
+
+	_, err = ReadImage(bytes.NewReader(buffer.Bytes()[:buffer.Len()-10]))
+	util.AssertError(t, "Could not read residuals: EOF", err)
+}
+
+func Test_writeImage_entropyCodings(t *testing.T) {
+	img := newTestImage(40, 30)
+	// The noise of the blue channel is stored as raw pixels, which can't be compressed, so use rings instead
+	for x := range img.B {
+		for y := range img.B[x] {
+			img.B[x][y] = uint8((x*x + y*y) / 4)
+		}
+	}
+	encodedImage, err := EncodeImage(*img, nil)
+	util.AssertNil(t, err)
+
+	sizes := map[EntropyCoding]int{}
+	for _, coding := range EntropyCodings {
+		encodedImage.EntropyCoding = coding
+		buffer := &bytes.Buffer{}
+
+		err = WriteImage(buffer, encodedImage)
+		util.AssertNil(t, err)
+		sizes[coding] = buffer.Len()
+
+		actual, err := ReadImage(buffer)
+		util.AssertNil(t, err)
+		util.AssertEqual(t, coding, actual.EntropyCoding)
+		util.AssertEqual(t, 0, buffer.Len())
+		assertAreasEqual(t, encodedImage.Areas, actual.Areas)
+	}
+
+	util.AssertTrue(t, sizes[RangeCoding] < sizes[NoEntropyCoding])
+}
+
+func Test_writeImage_valuesNotMatchingKind(t *testing.T) {
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 4, H: 2, Values: [4]uint8{1, 2, 1, 2}, Kind: VerticalArea},
+	}
+
+	err := WriteImage(&bytes.Buffer{}, &EncodedImage{Width: 4, Height: 2, Areas: [4][]EncodedArea{areas, areas, areas, areas}})
+
+	util.AssertError(t, "Areas of channel 0 cannot be stored: Could not write area 0: Values [1 2 1 2] of area at (0, 0) don't match its kind vertical", err)
+}
+
+func Test_writeImage_rawAreaWithInvalidPixels(t *testing.T) {
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 2, H: 2, Kind: RawArea, Pixels: [][]uint8{{1, 2}, {3}}},
+	}
+
+	err := WriteImage(&bytes.Buffer{}, &EncodedImage{Width: 2, Height: 2, Areas: [4][]EncodedArea{areas, areas, areas, areas}})
+
+	util.AssertError(t, "Areas of channel 0 cannot be stored: Could not write area 0: Pixels of raw area at (0, 0) don't have its size 2x2", err)
+}
+
+func Test_readImage_invalidAreaKind(t *testing.T) {
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 4, H: 2, Values: [4]uint8{3, 3, 3, 3}, Kind: ConstantArea},
+	}
+	buffer := &bytes.Buffer{}
+	err := WriteImage(buffer, &EncodedImage{Width: 4, Height: 2, Areas: [4][]EncodedArea{areas, areas, areas, areas}, EntropyCoding: NoEntropyCoding})
+	util.AssertNil(t, err)
+
+	// The kind follows the header (34 bytes for four channels) and the two sizes of the first area
+	data := buffer.Bytes()
+	util.AssertEqual(t, uint8(ConstantArea), data[36])
+	data[36] = 7
+
+	_, err = ReadImage(bytes.NewReader(data))
+	util.AssertError(t, "Invalid areas in channel 0: Could not read area 0: Invalid area kind 7", err)
+}
+
+func Test_writeAndRead_largeAreas(t *testing.T) {
+	areas := [4][]EncodedArea{
+		{{X: 0, Y: 0, W: 1000, H: 300, Values: [4]uint8{0, 10, 5, 20}}},
+		{{X: 0, Y: 0, W: 1000, H: 300, Values: [4]uint8{1, 2, 3, 4}}},
+		{
+			{X: 0, Y: 0, W: 1000, H: 128, Values: [4]uint8{255, 0, 255, 0}},
+			{X: 0, Y: 128, W: 127, H: 172, Values: [4]uint8{7, 7, 7, 7}},
+			{X: 127, Y: 128, W: 873, H: 172, Values: [4]uint8{8, 8, 8, 8}},
+		},
+		{{X: 0, Y: 0, W: 1000, H: 300, Values: [4]uint8{255, 255, 255, 255}}},
+	}
+
+	for _, coding := range EntropyCodings {
+		buffer := &bytes.Buffer{}
+		err := WriteImage(buffer, &EncodedImage{Width: 1000, Height: 300, Areas: areas, EntropyCoding: coding})
+		util.AssertNil(t, err)
+
+		actual, err := ReadImage(buffer)
+		util.AssertNil(t, err)
+		assertAreasEqual(t, areas, actual.Areas)
+	}
+}
@@ -0,0 +1,193 @@
+package encoding
+
+import (
+	"cobi/interpolate"
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+)
+
+// In mesh mode, the areas of a channel form a rectangular partition of a mesh: The values of an area don't belong to
+// its own corner pixels but to the vertices of the mesh, which lie on the corners of the area's rectangle. The
+// upper-left vertex of an area is its first pixel, the other vertices are the first pixels of the neighboring areas
+// (s. meshPositions). Areas sharing a vertex therefore share its value, which is stored only once, and neighboring
+// areas continue each other's gradients instead of showing seams.
+//
+// A vertex, which lies on the edge of an already known area (a T-junction), is not stored at all. Its value is
+// derived from the values along this edge, so that the new area continues the edge of the existing one.
+
+// meshPositions returns the positions of the four vertices of the area in the order of the values. The positions are
+// lattice points ranging from (0, 0) to (width, height) inclusive.
+func meshPositions(area EncodedArea) [4][2]int {
+	right := area.X + area.W
+	bottom := area.Y + area.H
+	return [4][2]int{
+		{area.X, area.Y},
+		{right, area.Y},
+		{area.X, bottom},
+		{right, bottom},
+	}
+}
+
+// interpolateArea returns the interpolated values of the area using the given kernel. In mesh mode, the values are
+// vertices of the mesh (s. meshPositions) instead of corner pixels of the area and are always interpolated bilinearly.
+func interpolateArea(area EncodedArea, mesh bool, kernel interpolate.Kernel) [][]uint8 {
+	if mesh {
+		return interpolate.InterpolateMesh(area.W, area.H, area.Values)
+	}
+	return area.GetInterpolatedArea(kernel)
+}
+
+// vertexTable contains the values of all known vertices of the mesh of a channel. Besides the vertices of the areas,
+// all lattice points on the edges of the areas are known, which are used for T-junctions. Unknown vertices are
+// predicted from the known ones (s. valuePredictor), so only their residuals are stored.
+type vertexTable struct {
+	lattice *valuePredictor
+	width   int
+	height  int
+}
+
+func newVertexTable(width, height int) *vertexTable {
+	return &vertexTable{
+		lattice: newValuePredictor(width+1, height+1, interpolate.BilinearKernel{}),
+		width:   width,
+		height:  height,
+	}
+}
+
+func (t *vertexTable) lookup(x, y int) (uint8, bool) {
+	return t.lattice.values[x][y], t.lattice.known[x][y]
+}
+
+// sample returns the vertex values of the area at the given position and which of them are known. Known vertices are
+// taken from the table, all others from the pixel at the vertex position. Vertices on the right and bottom border of
+// the image lie outside of it and use the nearest pixel.
+func (t *vertexTable) sample(channel [][]uint8, x, y, width, height int) ([4]uint8, [4]bool) {
+	var values [4]uint8
+	var knownValues [4]bool
+	for i, position := range meshPositions(EncodedArea{X: x, Y: y, W: width, H: height}) {
+		value, known := t.lookup(position[0], position[1])
+		knownValues[i] = known
+		if !known {
+			x := int(math.Min(float64(position[0]), float64(t.width-1)))
+			y := int(math.Min(float64(position[1]), float64(t.height-1)))
+			value = channel[x][y]
+		}
+		values[i] = value
+	}
+	return values, knownValues
+}
+
+// encodeValues returns the residuals of the vertices of the area, which are not yet known. An error is returned when
+// a known vertex has a different value than the area.
+func (t *vertexTable) encodeValues(area EncodedArea) ([]uint8, error) {
+	var residuals []uint8
+	for i, position := range meshPositions(area) {
+		value, known := t.lookup(position[0], position[1])
+		if known {
+			if value != area.Values[i] {
+				return nil, errors.New(fmt.Sprintf("Value %d of area at (%d, %d) differs from the value %d of the shared vertex (%d, %d)", area.Values[i], area.X, area.Y, value, position[0], position[1]))
+			}
+			continue
+		}
+
+		residuals = append(residuals, area.Values[i]-t.lattice.predictCorner(i, position, area.Values))
+		t.lattice.set(position[0], position[1], area.Values[i])
+	}
+	t.add(area)
+	return residuals, nil
+}
+
+// unknownVertices returns the number of vertices of the area, which are not yet known and for which residuals are
+// therefore stored.
+func (t *vertexTable) unknownVertices(area EncodedArea) int {
+	count := 0
+	for _, position := range meshPositions(area) {
+		if _, known := t.lookup(position[0], position[1]); !known {
+			count++
+		}
+	}
+	return count
+}
+
+// decodeValues is the inverse of encodeValues and sets the vertex values of the area from the known vertices and the
+// given residuals of the unknown ones.
+func (t *vertexTable) decodeValues(area *EncodedArea, residuals []uint8) {
+	for i, position := range meshPositions(*area) {
+		value, known := t.lookup(position[0], position[1])
+		if !known {
+			value = residuals[0] + t.lattice.predictCorner(i, position, area.Values)
+			residuals = residuals[1:]
+			t.lattice.set(position[0], position[1], value)
+		}
+		area.Values[i] = value
+	}
+	t.add(*area)
+}
+
+// writeValues writes the residuals of the unknown vertices of the area. No kind is stored, since all areas in mesh mode
+// are bilinear.
+func (t *vertexTable) writeValues(area EncodedArea, symbols symbolWriter) error {
+	if area.Kind != BilinearArea {
+		return errors.New(fmt.Sprintf("Area at (%d, %d) is a %s area but only bilinear areas are supported in mesh mode", area.X, area.Y, area.Kind))
+	}
+
+	residuals, err := t.encodeValues(area)
+	if err != nil {
+		return err
+	}
+	for _, residual := range residuals {
+		symbols.writeValue(residual)
+	}
+	return nil
+}
+
+func (t *vertexTable) readValues(area *EncodedArea, symbols symbolReader) error {
+	var err error
+	residuals := make([]uint8, t.unknownVertices(*area))
+	for i := range residuals {
+		residuals[i], err = symbols.readValue()
+		if err != nil {
+			return err
+		}
+	}
+	t.decodeValues(area, residuals)
+	return nil
+}
+
+// add stores the vertices of the area and the values along its edges. Already known lattice points keep their value.
+func (t *vertexTable) add(area EncodedArea) {
+	positions := meshPositions(area)
+	for i, position := range positions {
+		if _, known := t.lookup(position[0], position[1]); !known {
+			t.lattice.set(position[0], position[1], area.Values[i])
+		}
+	}
+
+	edges := [4][2]int{{0, 1}, {2, 3}, {0, 2}, {1, 3}}
+	for _, edge := range edges {
+		from, to := positions[edge[0]], positions[edge[1]]
+		horizontal := from[1] == to[1]
+		length := to[1] - from[1]
+		if horizontal {
+			length = to[0] - from[0]
+		}
+
+		for i := 0; i <= length; i++ {
+			x, y := from[0], from[1]+i
+			if horizontal {
+				x, y = from[0]+i, from[1]
+			}
+			if _, known := t.lookup(x, y); !known {
+				t.lattice.set(x, y, edgeValue(area.Values[edge[0]], area.Values[edge[1]], i, length))
+			}
+		}
+	}
+}
+
+// edgeValue returns the value at the given step of the edge between the two values. This is the same computation as
+// done by the interpolation, so that the derived values match the interpolated edge of the area.
+func edgeValue(from, to uint8, step, length int) uint8 {
+	increasePerStep := (float32(to) - float32(from)) / float32(length)
+	return uint8(float32(from) + float32(step)*increasePerStep)
+}
@@ -0,0 +1,145 @@
+package encoding
+
+import (
+	"bytes"
+	"cobi/image"
+	"cobi/metrics"
+	"cobi/util"
+	"testing"
+)
+
+func Test_vertexTable_sharedVertices(t *testing.T) {
+	// 1112
+	// 1112
+	// 3333
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 3, H: 2, Values: [4]uint8{0, 30, 20, 50}},  // 1
+		{X: 3, Y: 0, W: 1, H: 2, Values: [4]uint8{30, 40, 50, 60}}, // 2
+		{X: 0, Y: 2, W: 4, H: 1, Values: [4]uint8{20, 60, 20, 60}}, // 3
+	}
+
+	table := newVertexTable(4, 3)
+	var residuals [][]uint8
+	for _, area := range areas {
+		areaResiduals, err := table.encodeValues(area)
+		util.AssertNil(t, err)
+		residuals = append(residuals, areaResiduals)
+	}
+
+	// Only vertices, that aren't shared with previous areas, are stored
+	util.AssertEqual(t, 4, len(residuals[0]))
+	util.AssertEqual(t, 2, len(residuals[1]))
+	util.AssertEqual(t, 2, len(residuals[2]))
+
+	decoder := newVertexTable(4, 3)
+	for i, area := range areas {
+		decodedArea := EncodedArea{X: area.X, Y: area.Y, W: area.W, H: area.H}
+		util.AssertEqual(t, len(residuals[i]), decoder.unknownVertices(decodedArea))
+		decoder.decodeValues(&decodedArea, residuals[i])
+		util.AssertDeepEqual(t, area, decodedArea)
+	}
+}
+
+func Test_vertexTable_tJunction(t *testing.T) {
+	table := newVertexTable(4, 4)
+	table.add(EncodedArea{X: 0, Y: 0, W: 4, H: 2, Values: [4]uint8{0, 40, 0, 40}})
+
+	// The upper vertices of the area below lie on the bottom edge of the first area
+	value, known := table.lookup(1, 2)
+	util.AssertTrue(t, known)
+	util.AssertEqual(t, uint8(10), value)
+	util.AssertEqual(t, 2, table.unknownVertices(EncodedArea{X: 1, Y: 2, W: 2, H: 2}))
+
+	_, err := table.encodeValues(EncodedArea{X: 1, Y: 2, W: 2, H: 2, Values: [4]uint8{11, 30, 0, 0}})
+	util.AssertError(t, "Value 11 of area at (1, 2) differs from the value 10 of the shared vertex (1, 2)", err)
+}
+
+func Test_encodeAndDecodeImage_mesh(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	encodedImage, err := EncodeImage(*img, &Options{Quality: 50, Mesh: true})
+	util.AssertNil(t, err)
+	util.AssertTrue(t, encodedImage.Mesh)
+
+	buffer := &bytes.Buffer{}
+	err = WriteImage(buffer, encodedImage)
+	util.AssertNil(t, err)
+	actual, err := ReadImage(buffer)
+	util.AssertNil(t, err)
+	util.AssertTrue(t, actual.Mesh)
+	assertAreasEqual(t, encodedImage.Areas, actual.Areas)
+
+	decodedImage, err := DecodeImage(actual)
+	util.AssertNil(t, err)
+	expectedImage, err := DecodeMeshAreas(encodedImage.Areas)
+	util.AssertNil(t, err)
+	util.AssertArrayEqual(t, expectedImage.R, decodedImage.R)
+}
+
+func Test_encodeImage_meshNotWorseThanSampledVertices(t *testing.T) {
+	img := newSmoothTestImage(96, 64)
+	channels := [4][][]uint8{img.R, img.G, img.B, img.A}
+
+	encodedImage, err := EncodeImage(*img, &Options{Quality: DefaultQuality, Mesh: true})
+	util.AssertNil(t, err)
+
+	// The same areas with the pixels at the positions of the vertices as values
+	sampledImage := *encodedImage
+	for i, areas := range encodedImage.Areas {
+		table := newVertexTable(img.Width, img.Height)
+		sampledImage.Areas[i] = make([]EncodedArea, len(areas))
+		for j, area := range areas {
+			area.Values, _ = table.sample(channels[i], area.X, area.Y, area.W, area.H)
+			table.add(area)
+			sampledImage.Areas[i][j] = area
+		}
+	}
+
+	size, err := serializedSize(encodedImage)
+	util.AssertNil(t, err)
+	sampledSize, err := serializedSize(&sampledImage)
+	util.AssertNil(t, err)
+	util.AssertTrue(t, size <= sampledSize)
+	util.AssertTrue(t, meanSquaredImageError(t, img, encodedImage) <= meanSquaredImageError(t, img, &sampledImage))
+}
+
+// meanSquaredImageError returns the mean squared error of the color channels of the decoded image.
+func meanSquaredImageError(t *testing.T, img *image.Image, encodedImage *EncodedImage) float64 {
+	decodedImage, err := DecodeImage(encodedImage)
+	util.AssertNil(t, err)
+	m, err := metrics.Compare(img, decodedImage)
+	util.AssertNil(t, err)
+	return (m.R.MSE + m.G.MSE + m.B.MSE) / 3
+}
+
+func Test_encodeAndDecodeImage_meshLossless(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	encodedImage, err := EncodeImage(*img, &Options{Quality: 20, Mesh: true, Lossless: true})
+	util.AssertNil(t, err)
+	decodedImage, err := DecodeImage(encodedImage)
+
+	util.AssertNil(t, err)
+	util.AssertArrayEqual(t, img.R, decodedImage.R)
+	util.AssertArrayEqual(t, img.G, decodedImage.G)
+	util.AssertArrayEqual(t, img.B, decodedImage.B)
+	util.AssertArrayEqual(t, img.A, decodedImage.A)
+}
+
+func Test_encodeImage_meshAndNearLossless(t *testing.T) {
+	img := newTestImage(4, 4)
+
+	_, err := EncodeImage(*img, &Options{Quality: 50, Mesh: true, NearLossless: true, MaxPixelError: 2})
+
+	util.AssertError(t, "The near-lossless mode can't be combined with the mesh mode", err)
+}
+
+func Test_writeImage_meshWithAreaKind(t *testing.T) {
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 4, H: 2, Values: [4]uint8{3, 3, 3, 3}, Kind: ConstantArea},
+	}
+
+	err := WriteImage(&bytes.Buffer{}, &EncodedImage{Width: 4, Height: 2, Areas: [4][]EncodedArea{areas, areas, areas, areas}, Mesh: true})
+
+	util.AssertError(t, "Areas of channel 0 cannot be stored: Could not write area 0: Area at (0, 0) is a constant area but only bilinear areas are supported in mesh mode", err)
+}
@@ -0,0 +1,139 @@
+package encoding
+
+import (
+	"cobi/interpolate"
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"runtime"
+)
+
+// DefaultQuality is the quality used when no options are given to the encoder.
+const DefaultQuality = 50
+
+// Options are the parameters of the encoder.
+type Options struct {
+	// Quality ranges from 0 to 100 inclusive, higher is better. It determines the maximum interpolation error an area
+	// may have (s. AreaCostFunc.Threshold): Lower qualities allow larger errors and therefore result in fewer and larger
+	// areas, i.e. smaller files.
+	Quality int
+	// CostFunc determines the error of an interpolated area, which is compared to the threshold given by the quality.
+	// The DefaultCost is used when this is nil.
+	CostFunc AreaCostFunc
+	// NearLossless enables the near-lossless mode, in which an area is only accepted when no pixel deviates from its
+	// interpolated value by more than MaxPixelError. This holds in addition to the quality threshold.
+	NearLossless bool
+	// MaxPixelError is the maximum absolute difference between an original and a decoded value in near-lossless mode.
+	MaxPixelError int
+	// Lossless enables the lossless mode, in which the differences between the original and the interpolated values
+	// are stored as residual layer. The decoded image then equals the original one bit-exactly.
+	Lossless bool
+	// EntropyCoding determines how the areas are stored in a file. The default is RangeCoding.
+	EntropyCoding EntropyCoding
+	// Mesh enables the mesh mode, in which neighboring areas share the values of their common vertices. Each vertex
+	// is stored only once and there are no seams between the areas (s. EncodedImage.Mesh).
+	Mesh bool
+	// Workers is the number of channels or strips encoded concurrently. All available CPUs are used when this is 0.
+	// The encoded areas don't depend on the number of workers.
+	Workers int
+	// Partitioner determines how the channels are split into areas. The GreedyPartitioner is used when this is nil.
+	Partitioner Partitioner
+	// StripHeight splits the image into horizontal strips of this height, which are encoded independently of each
+	// other. This allows more concurrency than the four channels, but areas can't span multiple strips. The whole
+	// image is one strip when this is 0.
+	StripHeight int
+	// Interpolation determines the kernel filling the areas from their corner values. The default is
+	// BilinearInterpolation, which is the only one supported in mesh mode.
+	Interpolation Interpolation
+}
+
+// DefaultOptions returns the options used when no options are given to the encoder.
+func DefaultOptions() *Options {
+	return &Options{
+		Quality: DefaultQuality,
+	}
+}
+
+func (o *Options) getCostFunc() AreaCostFunc {
+	if o.CostFunc == nil {
+		return DefaultCost{}
+	}
+	return o.CostFunc
+}
+
+func (o *Options) getPartitioner() Partitioner {
+	if o.Partitioner == nil {
+		return GreedyPartitioner{}
+	}
+	return o.Partitioner
+}
+
+// getKernel returns the kernel of the interpolation, which must be valid (s. validate).
+func (o *Options) getKernel() interpolate.Kernel {
+	return kernels[o.Interpolation]
+}
+
+func (o *Options) getWorkers() int {
+	if o.Workers == 0 {
+		return runtime.NumCPU()
+	}
+	return o.Workers
+}
+
+// getStripHeight returns the height of the strips for an image of the given height.
+func (o *Options) getStripHeight(imageHeight int) int {
+	if o.StripHeight == 0 || o.StripHeight > imageHeight {
+		return imageHeight
+	}
+	return o.StripHeight
+}
+
+// getMaxPixelError returns the maximum pixel error in near-lossless mode and -1 when the mode is disabled.
+func (o *Options) getMaxPixelError() int {
+	if !o.NearLossless {
+		return -1
+	}
+	return o.MaxPixelError
+}
+
+func (o *Options) validate() error {
+	if o.Quality < 0 || o.Quality > 100 {
+		return errors.New(fmt.Sprintf("Quality must be between 0 and 100 but was %d", o.Quality))
+	}
+	if o.NearLossless && (o.MaxPixelError < 0 || o.MaxPixelError > 255) {
+		return errors.New(fmt.Sprintf("Maximum pixel error must be between 0 and 255 but was %d", o.MaxPixelError))
+	}
+	if o.NearLossless && o.Mesh {
+		// Shared vertices can't be adjusted to single areas, so not even an area of one pixel meets the maximum error.
+		return errors.New("The near-lossless mode can't be combined with the mesh mode")
+	}
+	if o.Workers < 0 {
+		return errors.New(fmt.Sprintf("Number of workers must not be negative but was %d", o.Workers))
+	}
+	if o.StripHeight < 0 {
+		return errors.New(fmt.Sprintf("Strip height must not be negative but was %d", o.StripHeight))
+	}
+	if o.StripHeight > 0 && o.getPartitioner().Partitioning() != GreedyPartitioning {
+		// Only the walk of the greedy partitioning covers a strip completely before the next one starts
+		return errors.New("Strips can only be used with the greedy partitioning")
+	}
+	if o.StripHeight > 0 && o.Mesh {
+		// The vertices on the border of two strips are shared, so the strips wouldn't be independent anymore.
+		return errors.New("Strips can't be combined with the mesh mode")
+	}
+	_, err := o.Interpolation.kernel(o.Mesh)
+	return err
+}
+
+// qualityThreshold maps the quality (0 to 100) to the threshold of the DefaultCost below which an area is accepted by
+// the encoder. The mapping is exponential: Each 25 quality steps reduce the threshold by a factor of 10, starting at
+// 0.5 for quality 0. The default quality of 50 therefore results in a threshold of 0.005 and quality 100 in 0.00005.
+func qualityThreshold(quality int) float64 {
+	return exponentialThreshold(quality, 0.5, 25)
+}
+
+// exponentialThreshold maps the quality (0 to 100) to a threshold, which starts at the given threshold for quality 0
+// and is reduced by a factor of 10 every given number of quality steps.
+func exponentialThreshold(quality int, threshold float64, qualitySteps float64) float64 {
+	return threshold * math.Pow(10, -float64(quality)/qualitySteps)
+}
@@ -0,0 +1,56 @@
+package encoding
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// Partitioning determines how the areas of a channel are arranged and therefore how they are stored.
+type Partitioning uint8
+
+const (
+	// GreedyPartitioning arranges the areas in the order of a walk over the channel, which places each area at the
+	// first uncovered pixel (in scanline order). The sizes of the areas are stored, their positions are restored by
+	// replaying this walk (s. coverageMap).
+	GreedyPartitioning Partitioning = iota
+	// QuadtreePartitioning arranges the areas as leaves of a quadtree, which recursively splits the channel into four
+	// quadrants. Only one split flag per quadrant is stored, which determines position and size of all areas
+	// (s. writeQuadtree).
+	QuadtreePartitioning
+)
+
+// Partitioner splits a channel into areas. The ChannelEncoder determines whether the interpolation of an area is
+// acceptable and creates the areas (s. ChannelEncoder.NewArea).
+type Partitioner interface {
+	// Partition returns the areas covering the channel of the encoder. They must not overlap and must be in the order
+	// required by the partitioning of the partitioner.
+	Partition(encoder *ChannelEncoder) []EncodedArea
+	// Partitioning returns how the areas of this partitioner are arranged and stored.
+	Partitioning() Partitioning
+}
+
+// Partitioners contains all available partitioners by their name.
+var Partitioners = map[string]Partitioner{
+	"greedy":   GreedyPartitioner{},
+	"quadtree": QuadtreePartitioner{},
+}
+
+// PartitionerNames returns the sorted names of all available partitioners.
+func PartitionerNames() []string {
+	var names []string
+	for name := range Partitioners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetPartitioner returns the partitioner with the given name (s. Partitioners).
+func GetPartitioner(name string) (Partitioner, error) {
+	partitioner, ok := Partitioners[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unknown partitioner %s, available are: %v", name, PartitionerNames()))
+	}
+	return partitioner, nil
+}
@@ -0,0 +1,74 @@
+package encoding
+
+import (
+	"bytes"
+	"cobi/metrics"
+	"cobi/util"
+	"testing"
+)
+
+func Test_partitioners(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	for _, name := range PartitionerNames() {
+		partitioner, err := GetPartitioner(name)
+		util.AssertNil(t, err)
+
+		encodedImage, err := EncodeImage(*img, &Options{Quality: 50, Partitioner: partitioner})
+		util.AssertNil(t, err)
+		util.AssertEqual(t, partitioner.Partitioning(), encodedImage.Partitioning)
+
+		buffer := &bytes.Buffer{}
+		err = WriteImage(buffer, encodedImage)
+		util.AssertNil(t, err)
+		actual, err := ReadImage(buffer)
+		util.AssertNil(t, err)
+		assertAreasEqual(t, encodedImage.Areas, actual.Areas)
+	}
+}
+
+func Test_getPartitioner(t *testing.T) {
+	partitioner, err := GetPartitioner("quadtree")
+	util.AssertNil(t, err)
+	util.AssertEqual(t, Partitioner(QuadtreePartitioner{}), partitioner)
+
+	_, err = GetPartitioner("foo")
+	util.AssertError(t, "Unknown partitioner foo, available are: [greedy quadtree]", err)
+}
+
+// BenchmarkPartitioners compares the partitioners by encoding time, file size and the mean PSNR of the color channels.
+func BenchmarkPartitioners(b *testing.B) {
+	img := newTestImage(320, 240)
+
+	for _, name := range PartitionerNames() {
+		b.Run(name, func(b *testing.B) {
+			options := &Options{Quality: DefaultQuality, Partitioner: Partitioners[name]}
+
+			var encodedImage *EncodedImage
+			var err error
+			for i := 0; i < b.N; i++ {
+				encodedImage, err = EncodeImage(*img, options)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+
+			size, err := serializedSize(encodedImage)
+			if err != nil {
+				b.Fatal(err)
+			}
+			decodedImage, err := DecodeImage(encodedImage)
+			if err != nil {
+				b.Fatal(err)
+			}
+			m, err := metrics.Compare(img, decodedImage)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportMetric(float64(size), "bytes")
+			b.ReportMetric((m.R.PSNR+m.G.PSNR+m.B.PSNR)/3, "PSNR")
+		})
+	}
+}
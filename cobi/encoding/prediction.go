@@ -0,0 +1,257 @@
+package encoding
+
+import (
+	"cobi/interpolate"
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+)
+
+// valuePredictor predicts the corner values of an area from the already decoded neighborhood. Encoder and decoder
+// process the areas of a channel in the same order and therefore make the same predictions, so only the difference
+// between the actual and the predicted value needs to be stored.
+type valuePredictor struct {
+	values [][]uint8
+	known  [][]bool
+	width  int
+	height int
+	// kernel fills the areas, whose pixels are known to the decoder after their values (s. add).
+	kernel interpolate.Kernel
+}
+
+func newValuePredictor(width, height int, kernel interpolate.Kernel) *valuePredictor {
+	values := make([][]uint8, width)
+	known := make([][]bool, width)
+	for x := 0; x < width; x++ {
+		values[x] = make([]uint8, height)
+		known[x] = make([]bool, height)
+	}
+
+	return &valuePredictor{
+		values: values,
+		known:  known,
+		width:  width,
+		height: height,
+		kernel: kernel,
+	}
+}
+
+// cornerPositions returns the pixel positions of the four corner values of the area in the order of the values.
+func cornerPositions(area EncodedArea) [4][2]int {
+	right := area.X + area.W - 1
+	bottom := area.Y + area.H - 1
+	return [4][2]int{
+		{area.X, area.Y},
+		{right, area.Y},
+		{area.X, bottom},
+		{right, bottom},
+	}
+}
+
+// encodeValues returns the differences (modulo 256) between the stored corner values of the area and their
+// predictions (s. AreaKind). The area must be placed, i.e. its position must be set.
+func (p *valuePredictor) encodeValues(area EncodedArea) []uint8 {
+	if area.Kind == RawArea {
+		return p.encodePixels(area)
+	}
+
+	var residuals []uint8
+	for i, position := range cornerPositions(area) {
+		if area.Kind.isStored(i) {
+			residuals = append(residuals, area.Values[i]-p.predictCorner(i, position, area.Values))
+		}
+		p.set(position[0], position[1], area.Values[i])
+	}
+	if area.Kind == QuadraticArea {
+		for i, prediction := range predictMidpoints(area.Values) {
+			residuals = append(residuals, area.Midpoints[i]-prediction)
+		}
+	}
+	p.add(area)
+	return residuals
+}
+
+// decodeValues is the inverse of encodeValues and sets the corner values of the area from the given residuals. The
+// kind of the area must be set.
+func (p *valuePredictor) decodeValues(area *EncodedArea, residuals []uint8) {
+	if area.Kind == RawArea {
+		p.decodePixels(area, residuals)
+		return
+	}
+
+	for i, position := range cornerPositions(*area) {
+		if area.Kind.isStored(i) {
+			area.Values[i] = residuals[0] + p.predictCorner(i, position, area.Values)
+			residuals = residuals[1:]
+		} else {
+			area.Values[i] = area.Values[area.Kind.sourceCorner(i)]
+		}
+		p.set(position[0], position[1], area.Values[i])
+	}
+	if area.Kind == QuadraticArea {
+		for i, prediction := range predictMidpoints(area.Values) {
+			area.Midpoints[i] = residuals[i] + prediction
+		}
+	}
+	p.add(*area)
+}
+
+// predictMidpoints predicts the midpoints of a quadratic area (s. EncodedArea.Midpoints) by the bilinear interpolation
+// of its corners, so the residuals are the deviations of the patch from the bilinear surface.
+func predictMidpoints(corners [4]uint8) [5]uint8 {
+	average := func(values ...uint8) uint8 {
+		sum := 0
+		for _, value := range values {
+			sum += int(value)
+		}
+		return uint8((sum + len(values)/2) / len(values))
+	}
+
+	return [5]uint8{
+		average(corners[0], corners[1]),
+		average(corners[0], corners[2]),
+		average(corners[0], corners[1], corners[2], corners[3]),
+		average(corners[1], corners[3]),
+		average(corners[2], corners[3]),
+	}
+}
+
+// encodePixels returns the differences (modulo 256) between the pixels of the raw area and their predictions. The
+// pixels are processed row by row, so each pixel is predicted from its left and upper neighbors (s. predict).
+func (p *valuePredictor) encodePixels(area EncodedArea) []uint8 {
+	residuals := make([]uint8, 0, area.W*area.H)
+	for y := 0; y < area.H; y++ {
+		for x := 0; x < area.W; x++ {
+			pixel := area.Pixels[x][y]
+			residuals = append(residuals, pixel-p.predict(area.X+x, area.Y+y))
+			p.set(area.X+x, area.Y+y, pixel)
+		}
+	}
+	return residuals
+}
+
+// decodePixels is the inverse of encodePixels and sets the pixels of the raw area from the given residuals.
+func (p *valuePredictor) decodePixels(area *EncodedArea, residuals []uint8) {
+	area.Pixels = make([][]uint8, area.W)
+	for x := range area.Pixels {
+		area.Pixels[x] = make([]uint8, area.H)
+	}
+
+	for y := 0; y < area.H; y++ {
+		for x := 0; x < area.W; x++ {
+			pixel := residuals[y*area.W+x] + p.predict(area.X+x, area.Y+y)
+			area.Pixels[x][y] = pixel
+			p.set(area.X+x, area.Y+y, pixel)
+		}
+	}
+}
+
+// writeValues writes the kind of the area followed by the residuals of its stored values or pixels.
+func (p *valuePredictor) writeValues(area EncodedArea, symbols symbolWriter) error {
+	if area.Kind == RawArea && !hasPixels(area) {
+		return errors.New(fmt.Sprintf("Pixels of raw area at (%d, %d) don't have its size %dx%d", area.X, area.Y, area.W, area.H))
+	}
+	if area.Kind != RawArea && !area.Kind.matches(area.Values) {
+		return errors.New(fmt.Sprintf("Values %v of area at (%d, %d) don't match its kind %s", area.Values, area.X, area.Y, area.Kind))
+	}
+
+	symbols.writeKind(area.Kind)
+	for _, residual := range p.encodeValues(area) {
+		if area.Kind == RawArea {
+			symbols.writePixel(residual)
+		} else {
+			symbols.writeValue(residual)
+		}
+	}
+	return nil
+}
+
+func (p *valuePredictor) readValues(area *EncodedArea, symbols symbolReader) error {
+	var err error
+	area.Kind, err = symbols.readKind()
+	if err != nil {
+		return err
+	}
+
+	numberOfResiduals := storedSymbols(*area) - 3
+	residuals := make([]uint8, numberOfResiduals)
+	for i := range residuals {
+		if area.Kind == RawArea {
+			residuals[i], err = symbols.readPixel()
+		} else {
+			residuals[i], err = symbols.readValue()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	p.decodeValues(area, residuals)
+	return nil
+}
+
+// hasPixels returns true when the pixels of the area have the size of the area.
+func hasPixels(area EncodedArea) bool {
+	if len(area.Pixels) != area.W {
+		return false
+	}
+	for _, column := range area.Pixels {
+		if len(column) != area.H {
+			return false
+		}
+	}
+	return true
+}
+
+// predictCorner predicts the value of the given corner. The values of all previous corners must already be set. The
+// bottom-right corner is predicted by continuing the gradient of the other three corners, all other corners are
+// predicted from their neighborhood (s. predict).
+func (p *valuePredictor) predictCorner(corner int, position [2]int, values [4]uint8) uint8 {
+	if corner == 3 {
+		prediction := int(values[1]) + int(values[2]) - int(values[0])
+		return uint8(math.Max(0, math.Min(255, float64(prediction))))
+	}
+	return p.predict(position[0], position[1])
+}
+
+// predict estimates the value at the given position from the nearest known pixel to the left and the nearest known
+// pixel above. When both exist, they are weighted by their inverse distance.
+func (p *valuePredictor) predict(x, y int) uint8 {
+	leftX := x - 1
+	for leftX >= 0 && !p.known[leftX][y] {
+		leftX--
+	}
+	upperY := y - 1
+	for upperY >= 0 && !p.known[x][upperY] {
+		upperY--
+	}
+
+	switch {
+	case leftX >= 0 && upperY >= 0:
+		leftDistance := x - leftX
+		upperDistance := y - upperY
+		weightedSum := int(p.values[leftX][y])*upperDistance + int(p.values[x][upperY])*leftDistance
+		totalDistance := leftDistance + upperDistance
+		return uint8((weightedSum + totalDistance/2) / totalDistance)
+	case leftX >= 0:
+		return p.values[leftX][y]
+	case upperY >= 0:
+		return p.values[x][upperY]
+	}
+
+	return 128
+}
+
+func (p *valuePredictor) set(x, y int, value uint8) {
+	p.values[x][y] = value
+	p.known[x][y] = true
+}
+
+// add stores the interpolated values of the area, which are known to the decoder from now on.
+func (p *valuePredictor) add(area EncodedArea) {
+	interpolatedValues := area.GetInterpolatedArea(p.kernel)
+	for x := 0; x < area.W; x++ {
+		for y := 0; y < area.H; y++ {
+			p.set(area.X+x, area.Y+y, interpolatedValues[x][y])
+		}
+	}
+}
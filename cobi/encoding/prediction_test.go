@@ -0,0 +1,127 @@
+package encoding
+
+import (
+	"cobi/interpolate"
+	"cobi/util"
+	"testing"
+)
+
+func Test_valuePredictor_predict(t *testing.T) {
+	predictor := newValuePredictor(4, 4, interpolate.BilinearKernel{})
+	util.AssertEqual(t, uint8(128), predictor.predict(0, 0))
+
+	predictor.set(0, 0, 10)
+	util.AssertEqual(t, uint8(10), predictor.predict(3, 0))
+	util.AssertEqual(t, uint8(10), predictor.predict(0, 3))
+
+	// Left pixel is closer than the upper one and therefore weighted higher
+	predictor.set(0, 2, 40)
+	predictor.set(1, 0, 10)
+	util.AssertEqual(t, uint8(30), predictor.predict(1, 2))
+}
+
+func Test_valuePredictor_encodeAndDecodeValues(t *testing.T) {
+	img := newTestImage(40, 30)
+	areas, err := EncodeAreas(*img, nil)
+	util.AssertNil(t, err)
+
+	encoder := newValuePredictor(img.Width, img.Height, interpolate.BilinearKernel{})
+	decoder := newValuePredictor(img.Width, img.Height, interpolate.BilinearKernel{})
+	for _, area := range areas[0] {
+		residuals := encoder.encodeValues(area)
+
+		decodedArea := EncodedArea{X: area.X, Y: area.Y, W: area.W, H: area.H, Kind: area.Kind}
+		decoder.decodeValues(&decodedArea, residuals)
+
+		util.AssertDeepEqual(t, area, decodedArea)
+	}
+}
+
+func Test_valuePredictor_smoothChannel(t *testing.T) {
+	// Horizontal gradient, which is split into areas with equal values at their common edges
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 4, H: 4, Values: [4]uint8{0, 30, 0, 30}},
+		{X: 4, Y: 0, W: 4, H: 4, Values: [4]uint8{40, 70, 40, 70}},
+		{X: 0, Y: 4, W: 8, H: 4, Values: [4]uint8{0, 70, 0, 70}},
+	}
+
+	predictor := newValuePredictor(8, 8, interpolate.BilinearKernel{})
+	var residuals [][]uint8
+	for _, area := range areas {
+		residuals = append(residuals, predictor.encodeValues(area))
+	}
+
+	// Only the first value and the gradients within the first row of areas are unpredictable
+	util.AssertArrayEqual(t, [][]uint8{
+		{128, 30, 0, 0},
+		{10, 30, 7, 0},
+		{0, 9, 0, 0},
+	}, residuals)
+}
+
+func Test_valuePredictor_areaKinds(t *testing.T) {
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 4, H: 2, Values: [4]uint8{0, 30, 0, 30}, Kind: HorizontalArea},
+		{X: 4, Y: 0, W: 4, H: 2, Values: [4]uint8{50, 50, 50, 50}, Kind: ConstantArea},
+		{X: 0, Y: 2, W: 8, H: 2, Values: [4]uint8{0, 0, 90, 90}, Kind: VerticalArea},
+	}
+
+	encoder := newValuePredictor(8, 4, interpolate.BilinearKernel{})
+	decoder := newValuePredictor(8, 4, interpolate.BilinearKernel{})
+	var residuals [][]uint8
+	for _, area := range areas {
+		areaResiduals := encoder.encodeValues(area)
+		residuals = append(residuals, areaResiduals)
+
+		decodedArea := EncodedArea{X: area.X, Y: area.Y, W: area.W, H: area.H, Kind: area.Kind}
+		decoder.decodeValues(&decodedArea, areaResiduals)
+		util.AssertDeepEqual(t, area, decodedArea)
+	}
+
+	// Only the stored values have residuals
+	util.AssertArrayEqual(t, [][]uint8{
+		{128, 30},
+		{20},
+		{0, 90},
+	}, residuals)
+}
+
+func Test_valuePredictor_rawArea(t *testing.T) {
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 3, H: 2, Values: [4]uint8{10, 10, 10, 10}, Kind: ConstantArea},
+		{X: 0, Y: 2, W: 3, H: 2, Kind: RawArea, Pixels: [][]uint8{{10, 200}, {12, 10}, {250, 12}}},
+	}
+
+	encoder := newValuePredictor(3, 4, interpolate.BilinearKernel{})
+	decoder := newValuePredictor(3, 4, interpolate.BilinearKernel{})
+	var residuals [][]uint8
+	for _, area := range areas {
+		areaResiduals := encoder.encodeValues(area)
+		residuals = append(residuals, areaResiduals)
+
+		decodedArea := EncodedArea{X: area.X, Y: area.Y, W: area.W, H: area.H, Kind: area.Kind}
+		decoder.decodeValues(&decodedArea, areaResiduals)
+		util.AssertDeepEqual(t, area, decodedArea)
+	}
+
+	// Pixels are predicted row by row from their left and upper neighbors
+	util.AssertArrayEqual(t, [][]uint8{
+		{138},
+		{0, 2, 239, 190, 160, 138},
+	}, residuals)
+}
+
+func Test_valuePredictor_quadraticArea(t *testing.T) {
+	area := EncodedArea{X: 0, Y: 0, W: 5, H: 4, Values: [4]uint8{10, 30, 50, 70}, Midpoints: [5]uint8{25, 30, 45, 49, 60}, Kind: QuadraticArea}
+
+	encoder := newValuePredictor(5, 4, interpolate.BilinearKernel{})
+	decoder := newValuePredictor(5, 4, interpolate.BilinearKernel{})
+	residuals := encoder.encodeValues(area)
+
+	decodedArea := EncodedArea{X: area.X, Y: area.Y, W: area.W, H: area.H, Kind: area.Kind}
+	decoder.decodeValues(&decodedArea, residuals)
+	util.AssertDeepEqual(t, area, decodedArea)
+
+	// The midpoints are predicted from the averages of the corners {20, 30, 40, 50, 60}
+	util.AssertDeepEqual(t, []uint8{5, 0, 5, 255, 0}, residuals[4:])
+}
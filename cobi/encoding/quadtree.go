@@ -0,0 +1,185 @@
+package encoding
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// quadrants splits the region into its upper-left, upper-right, bottom-left and bottom-right quadrant. For odd sizes,
+// the left and upper quadrants are one pixel larger. Regions with a width or height of one are only split along the
+// other dimension, so only the non-empty quadrants are returned. Regions of a single pixel can't be split at all.
+func quadrants(region EncodedArea) []EncodedArea {
+	leftWidth := (region.W + 1) / 2
+	upperHeight := (region.H + 1) / 2
+
+	var result []EncodedArea
+	for _, quadrant := range []EncodedArea{
+		{X: region.X, Y: region.Y, W: leftWidth, H: upperHeight},
+		{X: region.X + leftWidth, Y: region.Y, W: region.W - leftWidth, H: upperHeight},
+		{X: region.X, Y: region.Y + upperHeight, W: leftWidth, H: region.H - upperHeight},
+		{X: region.X + leftWidth, Y: region.Y + upperHeight, W: region.W - leftWidth, H: region.H - upperHeight},
+	} {
+		if quadrant.W > 0 && quadrant.H > 0 {
+			result = append(result, quadrant)
+		}
+	}
+	return result
+}
+
+// isSplittable returns true when the region consists of more than one pixel.
+func isSplittable(region EncodedArea) bool {
+	return region.W > 1 || region.H > 1
+}
+
+// QuadtreePartitioner recursively splits the channel into four quadrants until the interpolation of each quadrant is
+// acceptable. Its areas are stored with QuadtreePartitioning.
+type QuadtreePartitioner struct{}
+
+func (p QuadtreePartitioner) Partition(encoder *ChannelEncoder) []EncodedArea {
+	if encoder.Width() == 0 || encoder.Height() == 0 {
+		return nil
+	}
+	return p.partitionRegion(encoder, EncodedArea{W: encoder.Width(), H: encoder.Height()}, nil)
+}
+
+func (p QuadtreePartitioner) Partitioning() Partitioning {
+	return QuadtreePartitioning
+}
+
+// partitionRegion determines the areas of the region by splitting it recursively until the interpolation of each
+// quadrant is acceptable. The areas are the leaves of the quadtree in depth-first order. A split region becomes a raw
+// leaf instead, when the raw area needs fewer symbols than the leaves of its quadrants (s. leafSymbols).
+func (p QuadtreePartitioner) partitionRegion(encoder *ChannelEncoder, region EncodedArea, areas []EncodedArea) []EncodedArea {
+	if isSplittable(region) && !encoder.IsAcceptable(region.X, region.Y, region.W, region.H) {
+		firstLeaf := len(areas)
+		for _, quadrant := range quadrants(region) {
+			areas = p.partitionRegion(encoder, quadrant, areas)
+		}
+
+		if encoder.SupportsRawAreas() {
+			symbols := 0
+			for _, leaf := range areas[firstLeaf:] {
+				symbols += leafSymbols(leaf)
+			}
+			rawArea := encoder.NewRawArea(region.X, region.Y, region.W, region.H)
+			if leafSymbols(rawArea) < symbols {
+				areas = append(areas[:firstLeaf], rawArea)
+			}
+		}
+		return areas
+	}
+
+	return append(areas, encoder.NewArea(region.X, region.Y, region.W, region.H))
+}
+
+// leafSymbols returns the number of symbols stored for the leaf, which are the symbols of its area without the sizes
+// (s. storedSymbols). The split flags are neglected.
+func leafSymbols(area EncodedArea) int {
+	return storedSymbols(area) - 2
+}
+
+// writeQuadtree writes the split flags and values of the region, whose leaves must be the next areas. It returns the
+// remaining areas. A region is either split (flag true) and followed by its quadrants or it is a leaf (flag false)
+// followed by the values of its area. Regions of one pixel are always leaves, so no flag is written for them.
+func writeQuadtree(region EncodedArea, areas []EncodedArea, symbols symbolWriter, values valueCoder) ([]EncodedArea, error) {
+	if len(areas) == 0 {
+		return nil, errors.New(fmt.Sprintf("Missing area for region at (%d, %d) with size %dx%d", region.X, region.Y, region.W, region.H))
+	}
+
+	area := areas[0]
+	isLeaf := area.X == region.X && area.Y == region.Y && area.W == region.W && area.H == region.H
+	if isSplittable(region) {
+		symbols.writeFlag(!isLeaf)
+	}
+
+	if !isLeaf {
+		if !isSplittable(region) || area.X != region.X || area.Y != region.Y || area.W > region.W || area.H > region.H {
+			return nil, errors.New(fmt.Sprintf("Area at (%d, %d) with size %dx%d is not a quadrant of the region at (%d, %d) with size %dx%d", area.X, area.Y, area.W, area.H, region.X, region.Y, region.W, region.H))
+		}
+
+		var err error
+		for _, quadrant := range quadrants(region) {
+			areas, err = writeQuadtree(quadrant, areas, symbols, values)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return areas, nil
+	}
+
+	err := values.writeValues(area, symbols)
+	if err != nil {
+		return nil, err
+	}
+	return areas[1:], nil
+}
+
+// readQuadtree reads the areas of the region written by writeQuadtree and appends them to the given areas. At most
+// maxAreas areas are read.
+func readQuadtree(region EncodedArea, areas []EncodedArea, maxAreas int, symbols symbolReader, values valueCoder) ([]EncodedArea, error) {
+	split := false
+	if isSplittable(region) {
+		var err error
+		split, err = symbols.readFlag()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if split {
+		var err error
+		for _, quadrant := range quadrants(region) {
+			areas, err = readQuadtree(quadrant, areas, maxAreas, symbols, values)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return areas, nil
+	}
+
+	if len(areas) >= maxAreas {
+		return nil, errors.New(fmt.Sprintf("Quadtree contains more than the expected %d areas", maxAreas))
+	}
+
+	err := values.readValues(&region, symbols)
+	if err != nil {
+		return nil, err
+	}
+	return append(areas, region), nil
+}
+
+// writeQuadtreeAreas writes the areas of a channel, which must be the leaves of the quadtree of the whole channel in
+// depth-first order (s. writeQuadtree).
+func writeQuadtreeAreas(areas []EncodedArea, width, height int, symbols symbolWriter, values valueCoder) error {
+	if width == 0 || height == 0 {
+		if len(areas) != 0 {
+			return errors.New(fmt.Sprintf("Image of size %dx%d can't contain %d areas", width, height, len(areas)))
+		}
+		return nil
+	}
+
+	remainingAreas, err := writeQuadtree(EncodedArea{W: width, H: height}, areas, symbols, values)
+	if err != nil {
+		return err
+	}
+	if len(remainingAreas) != 0 {
+		return errors.New(fmt.Sprintf("Areas are not a quadtree, %d areas remain after the last quadrant", len(remainingAreas)))
+	}
+	return nil
+}
+
+// readQuadtreeAreas reads the areas written by writeQuadtreeAreas and ensures that their number is as expected.
+func readQuadtreeAreas(count, width, height int, symbols symbolReader, values valueCoder) ([]EncodedArea, error) {
+	if width == 0 || height == 0 {
+		return nil, nil
+	}
+
+	areas, err := readQuadtree(EncodedArea{W: width, H: height}, nil, count, symbols, values)
+	if err != nil {
+		return nil, err
+	}
+	if len(areas) != count {
+		return nil, errors.New(fmt.Sprintf("Quadtree contains %d areas but %d were expected", len(areas), count))
+	}
+	return areas, nil
+}
@@ -0,0 +1,80 @@
+package encoding
+
+import (
+	"bytes"
+	"cobi/util"
+	"testing"
+)
+
+func Test_quadrants(t *testing.T) {
+	actual := quadrants(EncodedArea{X: 2, Y: 4, W: 5, H: 3})
+
+	util.AssertEqual(t, 4, len(actual))
+	util.AssertDeepEqual(t, EncodedArea{X: 2, Y: 4, W: 3, H: 2}, actual[0])
+	util.AssertDeepEqual(t, EncodedArea{X: 5, Y: 4, W: 2, H: 2}, actual[1])
+	util.AssertDeepEqual(t, EncodedArea{X: 2, Y: 6, W: 3, H: 1}, actual[2])
+	util.AssertDeepEqual(t, EncodedArea{X: 5, Y: 6, W: 2, H: 1}, actual[3])
+}
+
+func Test_quadrants_singleRow(t *testing.T) {
+	actual := quadrants(EncodedArea{X: 0, Y: 0, W: 3, H: 1})
+
+	util.AssertEqual(t, 2, len(actual))
+	util.AssertDeepEqual(t, EncodedArea{X: 0, Y: 0, W: 2, H: 1}, actual[0])
+	util.AssertDeepEqual(t, EncodedArea{X: 2, Y: 0, W: 1, H: 1}, actual[1])
+}
+
+func Test_encodeAreas_quadtree(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	for _, mesh := range []bool{false, true} {
+		encodedImage, err := EncodeImage(*img, &Options{Quality: 50, Partitioner: QuadtreePartitioner{}, Mesh: mesh})
+		util.AssertNil(t, err)
+
+		for _, coding := range EntropyCodings {
+			encodedImage.EntropyCoding = coding
+			buffer := &bytes.Buffer{}
+			err = WriteImage(buffer, encodedImage)
+			util.AssertNil(t, err)
+
+			actual, err := ReadImage(buffer)
+			util.AssertNil(t, err)
+			util.AssertEqual(t, QuadtreePartitioning, actual.Partitioning)
+			assertAreasEqual(t, encodedImage.Areas, actual.Areas)
+		}
+
+		decodedImage, err := DecodeImage(encodedImage)
+		util.AssertNil(t, err)
+		util.AssertEqual(t, 40, decodedImage.Width)
+		util.AssertEqual(t, 30, decodedImage.Height)
+	}
+}
+
+func Test_encodeAreas_quadtreeNearLossless(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	areas, err := EncodeAreas(*img, &Options{Quality: 0, Partitioner: QuadtreePartitioner{}, NearLossless: true, MaxPixelError: 3})
+	util.AssertNil(t, err)
+	decodedImage, err := DecodeAreas(areas)
+	util.AssertNil(t, err)
+
+	util.AssertFalse(t, exceedsMaxPixelError(img.B, 0, 0, decodedImage.B, 3))
+}
+
+func Test_writeImage_quadtreeWithInvalidAreas(t *testing.T) {
+	// Valid for the greedy but not for the quadtree partitioning
+	areas := []EncodedArea{
+		{X: 0, Y: 0, W: 3, H: 2},
+		{X: 3, Y: 0, W: 1, H: 2},
+	}
+
+	err := WriteImage(&bytes.Buffer{}, &EncodedImage{Width: 4, Height: 2, Areas: [4][]EncodedArea{areas, areas, areas, areas}, Partitioning: QuadtreePartitioning})
+
+	util.AssertError(t, "Areas of channel 0 cannot be stored: Area at (0, 0) with size 3x2 is not a quadrant of the region at (0, 0) with size 2x1", err)
+}
+
+func Test_encodeAreas_quadtreeWithStrips(t *testing.T) {
+	_, err := EncodeAreas(*newTestImage(4, 4), &Options{Partitioner: QuadtreePartitioner{}, StripHeight: 2})
+
+	util.AssertError(t, "Strips can only be used with the greedy partitioning", err)
+}
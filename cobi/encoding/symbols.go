@@ -0,0 +1,310 @@
+package encoding
+
+import (
+	"bytes"
+	"cobi/entropy"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"sort"
+)
+
+// EntropyCoding determines how the symbols of the area stream (sizes, kinds, values, pixels and split flags of the
+// areas) are stored.
+type EntropyCoding uint8
+
+const (
+	// RangeCoding codes the symbols with an adaptive range coder. Sizes, kinds, values, pixels and split flags are
+	// modeled separately.
+	RangeCoding EntropyCoding = iota
+	// NoEntropyCoding stores each symbol as one byte.
+	NoEntropyCoding
+)
+
+// maxSize is the largest width or height of an area that can be read. Sizes are stored as unsigned varints
+// (s. binary.AppendUvarint), which are split into one symbol per byte.
+const maxSize = math.MaxInt32
+
+// EntropyCodings contains all available entropy codings by their name.
+var EntropyCodings = map[string]EntropyCoding{
+	"range": RangeCoding,
+	"none":  NoEntropyCoding,
+}
+
+// EntropyCodingNames returns the sorted names of all available entropy codings.
+func EntropyCodingNames() []string {
+	var names []string
+	for name := range EntropyCodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetEntropyCoding returns the entropy coding with the given name (s. EntropyCodings).
+func GetEntropyCoding(name string) (EntropyCoding, error) {
+	coding, ok := EntropyCodings[name]
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("Unknown entropy coding %s, available are: %v", name, EntropyCodingNames()))
+	}
+	return coding, nil
+}
+
+// symbolWriter writes the symbols of the area stream. The stream is complete after close has been called.
+type symbolWriter interface {
+	writeSize(size int)
+	writeKind(kind AreaKind)
+	writeValue(value uint8)
+	writePixel(pixel uint8)
+	writeFlag(flag bool)
+	close() error
+}
+
+// symbolReader reads the symbols written by the symbolWriter of the same entropy coding.
+type symbolReader interface {
+	readSize() (int, error)
+	readKind() (AreaKind, error)
+	readValue() (uint8, error)
+	readPixel() (uint8, error)
+	readFlag() (bool, error)
+}
+
+func newSymbolWriter(coding EntropyCoding, buffer *bytes.Buffer) (symbolWriter, error) {
+	switch coding {
+	case NoEntropyCoding:
+		return &rawSymbolWriter{buffer: buffer}, nil
+	case RangeCoding:
+		return newRangeSymbolWriter(buffer), nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported entropy coding %d", coding))
+}
+
+func newSymbolReader(coding EntropyCoding, reader byteReader) (symbolReader, error) {
+	switch coding {
+	case NoEntropyCoding:
+		return &rawSymbolReader{reader: reader}, nil
+	case RangeCoding:
+		return newRangeSymbolReader(reader)
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported entropy coding %d", coding))
+}
+
+// rawSymbolWriter writes each symbol as one byte.
+type rawSymbolWriter struct {
+	buffer *bytes.Buffer
+}
+
+func (w *rawSymbolWriter) writeSize(size int) {
+	w.buffer.Write(binary.AppendUvarint(nil, uint64(size)))
+}
+
+func (w *rawSymbolWriter) writeKind(kind AreaKind) {
+	w.buffer.WriteByte(uint8(kind))
+}
+
+func (w *rawSymbolWriter) writeValue(value uint8) {
+	w.buffer.WriteByte(value)
+}
+
+func (w *rawSymbolWriter) writePixel(pixel uint8) {
+	w.buffer.WriteByte(pixel)
+}
+
+func (w *rawSymbolWriter) writeFlag(flag bool) {
+	if flag {
+		w.buffer.WriteByte(1)
+	} else {
+		w.buffer.WriteByte(0)
+	}
+}
+
+func (w *rawSymbolWriter) close() error {
+	return nil
+}
+
+type rawSymbolReader struct {
+	reader byteReader
+}
+
+func (r *rawSymbolReader) readSize() (int, error) {
+	return readVarintSize(r.reader)
+}
+
+func (r *rawSymbolReader) readKind() (AreaKind, error) {
+	b, err := r.reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b >= numberOfAreaKinds {
+		return 0, errors.New(fmt.Sprintf("Invalid area kind %d", b))
+	}
+	return AreaKind(b), nil
+}
+
+func (r *rawSymbolReader) readValue() (uint8, error) {
+	return r.reader.ReadByte()
+}
+
+func (r *rawSymbolReader) readPixel() (uint8, error) {
+	return r.reader.ReadByte()
+}
+
+func (r *rawSymbolReader) readFlag() (bool, error) {
+	b, err := r.reader.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	if b > 1 {
+		return false, errors.New(fmt.Sprintf("Invalid flag %d", b))
+	}
+	return b == 1, nil
+}
+
+// rangeSymbolWriter codes the symbols with a range coder. Since the decoder needs to know where the coded data ends,
+// the data is prefixed by its length (4 bytes, big-endian).
+type rangeSymbolWriter struct {
+	buffer     *bytes.Buffer
+	codedData  *bytes.Buffer
+	encoder    *entropy.RangeEncoder
+	sizeModel  *entropy.Model
+	kindModel  *entropy.Model
+	valueModel *entropy.Model
+	pixelModel *entropy.Model
+	flagModel  *entropy.Model
+}
+
+func newRangeSymbolWriter(buffer *bytes.Buffer) *rangeSymbolWriter {
+	codedData := &bytes.Buffer{}
+	return &rangeSymbolWriter{
+		buffer:     buffer,
+		codedData:  codedData,
+		encoder:    entropy.NewRangeEncoder(codedData),
+		sizeModel:  entropy.NewModel(256),
+		kindModel:  entropy.NewModel(numberOfAreaKinds),
+		valueModel: entropy.NewModel(256),
+		pixelModel: entropy.NewModel(256),
+		flagModel:  entropy.NewModel(2),
+	}
+}
+
+func (w *rangeSymbolWriter) writeSize(size int) {
+	for _, b := range binary.AppendUvarint(nil, uint64(size)) {
+		w.encoder.Encode(w.sizeModel, int(b))
+	}
+}
+
+func (w *rangeSymbolWriter) writeKind(kind AreaKind) {
+	w.encoder.Encode(w.kindModel, int(kind))
+}
+
+func (w *rangeSymbolWriter) writeValue(value uint8) {
+	w.encoder.Encode(w.valueModel, int(value))
+}
+
+func (w *rangeSymbolWriter) writePixel(pixel uint8) {
+	w.encoder.Encode(w.pixelModel, int(pixel))
+}
+
+func (w *rangeSymbolWriter) writeFlag(flag bool) {
+	symbol := 0
+	if flag {
+		symbol = 1
+	}
+	w.encoder.Encode(w.flagModel, symbol)
+}
+
+func (w *rangeSymbolWriter) close() error {
+	err := w.encoder.Flush()
+	if err != nil {
+		return err
+	}
+
+	w.buffer.Write(binary.BigEndian.AppendUint32(nil, uint32(w.codedData.Len())))
+	_, err = w.codedData.WriteTo(w.buffer)
+	return err
+}
+
+type rangeSymbolReader struct {
+	decoder    *entropy.RangeDecoder
+	sizeModel  *entropy.Model
+	kindModel  *entropy.Model
+	valueModel *entropy.Model
+	pixelModel *entropy.Model
+	flagModel  *entropy.Model
+}
+
+func newRangeSymbolReader(reader byteReader) (*rangeSymbolReader, error) {
+	var codedLength uint32
+	err := binary.Read(reader, binary.BigEndian, &codedLength)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read length of range coded data")
+	}
+
+	codedData := &bytes.Buffer{}
+	_, err = io.CopyN(codedData, reader, int64(codedLength))
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read range coded data")
+	}
+
+	decoder, err := entropy.NewRangeDecoder(codedData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rangeSymbolReader{
+		decoder:    decoder,
+		sizeModel:  entropy.NewModel(256),
+		kindModel:  entropy.NewModel(numberOfAreaKinds),
+		valueModel: entropy.NewModel(256),
+		pixelModel: entropy.NewModel(256),
+		flagModel:  entropy.NewModel(2),
+	}, nil
+}
+
+func (r *rangeSymbolReader) readSize() (int, error) {
+	return readVarintSize(rangeSizeReader{r})
+}
+
+func (r *rangeSymbolReader) readKind() (AreaKind, error) {
+	symbol, err := r.decoder.Decode(r.kindModel)
+	return AreaKind(symbol), err
+}
+
+func (r *rangeSymbolReader) readValue() (uint8, error) {
+	symbol, err := r.decoder.Decode(r.valueModel)
+	return uint8(symbol), err
+}
+
+func (r *rangeSymbolReader) readPixel() (uint8, error) {
+	symbol, err := r.decoder.Decode(r.pixelModel)
+	return uint8(symbol), err
+}
+
+func (r *rangeSymbolReader) readFlag() (bool, error) {
+	symbol, err := r.decoder.Decode(r.flagModel)
+	return symbol == 1, err
+}
+
+// rangeSizeReader reads the bytes of a varint coded size from the range coder.
+type rangeSizeReader struct {
+	reader *rangeSymbolReader
+}
+
+func (r rangeSizeReader) ReadByte() (byte, error) {
+	symbol, err := r.reader.decoder.Decode(r.reader.sizeModel)
+	return byte(symbol), err
+}
+
+// readVarintSize reads a size, which is stored as unsigned varint.
+func readVarintSize(reader io.ByteReader) (int, error) {
+	size, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, err
+	}
+	if size > maxSize {
+		return 0, errors.New(fmt.Sprintf("Size %d exceeds the maximum size of %d", size, maxSize))
+	}
+	return int(size), nil
+}
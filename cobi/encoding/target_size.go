@@ -0,0 +1,77 @@
+package encoding
+
+import (
+	"cobi/image"
+	"fmt"
+	"github.com/hauke96/sigolo"
+	"github.com/pkg/errors"
+)
+
+// EncodeImageWithTargetSize encodes the image with the highest quality whose serialized size (s. WriteImage) does not
+// exceed the given number of bytes. The quality of the given options is ignored, all other options are used as they
+// are. Besides the encoded image, the chosen quality is returned.
+//
+// The quality is determined by a binary search, which assumes that the file size grows with the quality. This is not
+// strictly the case, so a slightly higher quality might fit as well.
+func EncodeImageWithTargetSize(img image.Image, targetSize int, options *Options) (*EncodedImage, int, error) {
+	if options == nil {
+		options = DefaultOptions()
+	}
+
+	var bestImage *EncodedImage
+	bestQuality := -1
+	smallestSize := -1
+
+	minQuality, maxQuality := 0, 100
+	for minQuality <= maxQuality {
+		quality := (minQuality + maxQuality) / 2
+
+		qualityOptions := *options
+		qualityOptions.Quality = quality
+		encodedImage, err := EncodeImage(img, &qualityOptions)
+		if err != nil {
+			return nil, -1, err
+		}
+
+		size, err := serializedSize(encodedImage)
+		if err != nil {
+			return nil, -1, err
+		}
+		sigolo.Debug("Quality %d results in %d bytes (target size is %d bytes)", quality, size, targetSize)
+
+		if smallestSize == -1 || size < smallestSize {
+			smallestSize = size
+		}
+
+		if size <= targetSize {
+			bestImage = encodedImage
+			bestQuality = quality
+			minQuality = quality + 1
+		} else {
+			maxQuality = quality - 1
+		}
+	}
+
+	if bestQuality == -1 {
+		return nil, -1, errors.New(fmt.Sprintf("Target size of %d bytes cannot be reached, the smallest encoding has %d bytes", targetSize, smallestSize))
+	}
+
+	return bestImage, bestQuality, nil
+}
+
+// serializedSize returns the number of bytes WriteImage produces for the given encoded image.
+func serializedSize(encodedImage *EncodedImage) (int, error) {
+	counter := &countingWriter{}
+	err := WriteImage(counter, encodedImage)
+	return counter.count, err
+}
+
+// countingWriter discards all data but counts the number of written bytes.
+type countingWriter struct {
+	count int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += len(p)
+	return len(p), nil
+}
@@ -0,0 +1,31 @@
+package encoding
+
+import (
+	"cobi/util"
+	"testing"
+)
+
+func Test_encodeImageWithTargetSize(t *testing.T) {
+	img := newTestImage(40, 30)
+	defaultImage, err := EncodeImage(*img, nil)
+	util.AssertNil(t, err)
+	defaultSize, err := serializedSize(defaultImage)
+	util.AssertNil(t, err)
+
+	encodedImage, quality, err := EncodeImageWithTargetSize(*img, defaultSize, nil)
+
+	util.AssertNil(t, err)
+	util.AssertTrue(t, quality >= 0)
+	size, err := serializedSize(encodedImage)
+	util.AssertNil(t, err)
+	util.AssertTrue(t, size <= defaultSize)
+}
+
+func Test_encodeImageWithTargetSize_targetSizeTooSmall(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	_, quality, err := EncodeImageWithTargetSize(*img, 10, nil)
+
+	util.AssertNotNil(t, err)
+	util.AssertEqual(t, -1, quality)
+}
@@ -0,0 +1,71 @@
+package entropy
+
+// Frequency added to a symbol each time it has been coded.
+const frequencyIncrement = 24
+
+// Maximum sum of all frequencies. When it's exceeded, all frequencies are halved. This keeps the model adaptive and
+// ensures enough precision in the range coder, which divides its range by the total frequency.
+const maxTotalFrequency = 1 << 16
+
+// Model is an adaptive order-0 model of the symbols 0 to n-1. It estimates the probability of each symbol by its
+// frequency so far. Encoder and decoder must use models of the same size and code the same symbols with them, so that
+// both models stay in sync.
+type Model struct {
+	frequencies    []uint32
+	totalFrequency uint32
+}
+
+// NewModel creates a model for the symbols 0 to numberOfSymbols-1, which are initially equally likely.
+func NewModel(numberOfSymbols int) *Model {
+	frequencies := make([]uint32, numberOfSymbols)
+	for i := range frequencies {
+		frequencies[i] = 1
+	}
+
+	return &Model{
+		frequencies:    frequencies,
+		totalFrequency: uint32(numberOfSymbols),
+	}
+}
+
+// NumberOfSymbols returns the number of symbols this model can code.
+func (m *Model) NumberOfSymbols() int {
+	return len(m.frequencies)
+}
+
+// interval returns the cumulative frequency of all symbols smaller than the given one and the frequency of the symbol.
+func (m *Model) interval(symbol int) (uint32, uint32) {
+	cumulativeFrequency := uint32(0)
+	for i := 0; i < symbol; i++ {
+		cumulativeFrequency += m.frequencies[i]
+	}
+	return cumulativeFrequency, m.frequencies[symbol]
+}
+
+// find returns the symbol whose interval contains the given cumulative frequency together with this interval.
+func (m *Model) find(value uint32) (int, uint32, uint32) {
+	cumulativeFrequency := uint32(0)
+	for symbol, frequency := range m.frequencies {
+		if value < cumulativeFrequency+frequency {
+			return symbol, cumulativeFrequency, frequency
+		}
+		cumulativeFrequency += frequency
+	}
+
+	// Not reachable for values smaller than the total frequency
+	last := len(m.frequencies) - 1
+	return last, cumulativeFrequency - m.frequencies[last], m.frequencies[last]
+}
+
+func (m *Model) update(symbol int) {
+	m.frequencies[symbol] += frequencyIncrement
+	m.totalFrequency += frequencyIncrement
+
+	if m.totalFrequency > maxTotalFrequency {
+		m.totalFrequency = 0
+		for i := range m.frequencies {
+			m.frequencies[i] = (m.frequencies[i] + 1) / 2
+			m.totalFrequency += m.frequencies[i]
+		}
+	}
+}
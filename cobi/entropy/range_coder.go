@@ -0,0 +1,127 @@
+package entropy
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// The range is renormalized (shifted by one byte) whenever it falls below this value.
+const rangeNormalizationThreshold = 1 << 24
+
+// RangeEncoder is an adaptive range coder with carry propagation as known from LZMA. Each symbol is coded with a
+// Model, which determines the probability of the symbol. Likely symbols take less than a byte, unlikely symbols more.
+type RangeEncoder struct {
+	writer    io.ByteWriter
+	low       uint64
+	rng       uint32
+	cache     uint8
+	cacheSize int
+	err       error
+}
+
+// NewRangeEncoder creates an encoder writing its output to the given writer. The output is complete after Flush has
+// been called.
+func NewRangeEncoder(writer io.ByteWriter) *RangeEncoder {
+	return &RangeEncoder{
+		writer:    writer,
+		rng:       0xFFFFFFFF,
+		cacheSize: 1,
+	}
+}
+
+// Encode writes the symbol according to the probabilities of the model and updates the model afterwards.
+func (e *RangeEncoder) Encode(model *Model, symbol int) {
+	cumulativeFrequency, frequency := model.interval(symbol)
+
+	r := e.rng / model.totalFrequency
+	e.low += uint64(cumulativeFrequency * r)
+	e.rng = frequency * r
+
+	for e.rng < rangeNormalizationThreshold {
+		e.rng <<= 8
+		e.shiftLow()
+	}
+
+	model.update(symbol)
+}
+
+// Flush writes the remaining state of the encoder. It returns the first error that occurred while writing.
+func (e *RangeEncoder) Flush() error {
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+	return e.err
+}
+
+// shiftLow writes the upper byte of the low value. A byte is delayed in the cache as long as a carry may still change
+// it, which is the case while the following bytes are 0xFF.
+func (e *RangeEncoder) shiftLow() {
+	if uint32(e.low) < 0xFF000000 || e.low>>32 != 0 {
+		carry := uint8(e.low >> 32)
+		value := e.cache
+		for ; e.cacheSize > 0; e.cacheSize-- {
+			e.writeByte(value + carry)
+			value = 0xFF
+		}
+		e.cache = uint8(e.low >> 24)
+	}
+	e.cacheSize++
+	e.low = (e.low & 0x00FFFFFF) << 8
+}
+
+func (e *RangeEncoder) writeByte(b uint8) {
+	if e.err == nil {
+		e.err = e.writer.WriteByte(b)
+	}
+}
+
+// RangeDecoder decodes the output of a RangeEncoder. It must use the same models in the same order as the encoder.
+type RangeDecoder struct {
+	reader io.ByteReader
+	code   uint32
+	rng    uint32
+}
+
+// NewRangeDecoder creates a decoder reading from the given reader. It already reads the first bytes of the input.
+func NewRangeDecoder(reader io.ByteReader) (*RangeDecoder, error) {
+	d := &RangeDecoder{
+		reader: reader,
+		rng:    0xFFFFFFFF,
+	}
+
+	for i := 0; i < 5; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not initialize range decoder")
+		}
+		d.code = d.code<<8 | uint32(b)
+	}
+
+	return d, nil
+}
+
+// Decode reads the next symbol according to the probabilities of the model and updates the model afterwards.
+func (d *RangeDecoder) Decode(model *Model) (int, error) {
+	r := d.rng / model.totalFrequency
+	value := d.code / r
+	if value >= model.totalFrequency {
+		return 0, errors.New(fmt.Sprintf("Invalid range coded data: Value %d exceeds total frequency %d", value, model.totalFrequency))
+	}
+
+	symbol, cumulativeFrequency, frequency := model.find(value)
+	d.code -= cumulativeFrequency * r
+	d.rng = frequency * r
+
+	for d.rng < rangeNormalizationThreshold {
+		b, err := d.reader.ReadByte()
+		if err != nil {
+			return 0, errors.Wrap(err, "Unexpected end of range coded data")
+		}
+		d.code = d.code<<8 | uint32(b)
+		d.rng <<= 8
+	}
+
+	model.update(symbol)
+	return symbol, nil
+}
@@ -0,0 +1,76 @@
+package entropy
+
+import (
+	"bytes"
+	"cobi/util"
+	"math/rand"
+	"testing"
+)
+
+func Test_rangeCoder_roundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	var symbols []int
+	for i := 0; i < 10000; i++ {
+		// Skewed distribution with some outliers
+		symbol := int(random.ExpFloat64() * 4)
+		if symbol > 255 || i%997 == 0 {
+			symbol = 255
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	buffer := &bytes.Buffer{}
+	encoder := NewRangeEncoder(buffer)
+	encoderModel := NewModel(256)
+	for _, symbol := range symbols {
+		encoder.Encode(encoderModel, symbol)
+	}
+	util.AssertNil(t, encoder.Flush())
+
+	// Skewed data must be compressed well below one byte per symbol
+	util.AssertTrue(t, buffer.Len() < len(symbols)/2)
+
+	decoder, err := NewRangeDecoder(buffer)
+	util.AssertNil(t, err)
+	decoderModel := NewModel(256)
+	for i, expected := range symbols {
+		actual, err := decoder.Decode(decoderModel)
+		util.AssertNil(t, err)
+		if expected != actual {
+			t.Fatalf("Symbol %d: expected %d but found %d", i, expected, actual)
+		}
+	}
+	util.AssertEqual(t, 0, buffer.Len())
+}
+
+func Test_rangeCoder_multipleModels(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	encoder := NewRangeEncoder(buffer)
+	smallModel := NewModel(2)
+	largeModel := NewModel(1000)
+	for i := 0; i < 1000; i++ {
+		encoder.Encode(smallModel, i%2)
+		encoder.Encode(largeModel, i)
+	}
+	util.AssertNil(t, encoder.Flush())
+
+	decoder, err := NewRangeDecoder(buffer)
+	util.AssertNil(t, err)
+	smallModel = NewModel(2)
+	largeModel = NewModel(1000)
+	for i := 0; i < 1000; i++ {
+		symbol, err := decoder.Decode(smallModel)
+		util.AssertNil(t, err)
+		util.AssertEqual(t, i%2, symbol)
+
+		symbol, err = decoder.Decode(largeModel)
+		util.AssertNil(t, err)
+		util.AssertEqual(t, i, symbol)
+	}
+}
+
+func Test_rangeDecoder_truncatedData(t *testing.T) {
+	_, err := NewRangeDecoder(bytes.NewReader([]byte{0, 1}))
+
+	util.AssertNotNil(t, err)
+}
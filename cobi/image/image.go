@@ -34,6 +34,10 @@ func (img *Image) Bounds() image.Rectangle {
 }
 
 func (img *Image) At(x, y int) color.Color {
+	if !(image.Point{X: x, Y: y}.In(img.Bounds())) {
+		return color.RGBA{}
+	}
+
 	return color.RGBA{
 		R: img.R[x][y],
 		G: img.G[x][y],
@@ -56,7 +60,8 @@ func New(width, height int) *Image {
 }
 
 func FromGoImage(goImg image.Image) (*Image, error) {
-	w, h := goImg.Bounds().Max.X, goImg.Bounds().Max.Y
+	bounds := goImg.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
 
 	img := New(w, h)
 
@@ -68,7 +73,7 @@ func FromGoImage(goImg image.Image) (*Image, error) {
 		img.A[x] = make([]uint8, h)
 
 		for y := 0; y < h; y++ {
-			r, g, b, a := goImg.At(x, y).RGBA()
+			r, g, b, a := goImg.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
 			r /= 256
 			g /= 256
 			b /= 256
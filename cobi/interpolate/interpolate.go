@@ -1,50 +1,210 @@
 package interpolate
 
-// Interpolate returns the interpolated area between the four given values. The values represent the following corners:
+import "math"
+
+// Interpolate returns the interpolated area between the four given values using the BilinearKernel. The values
+// represent the following corners:
 // [0] - upper left
 // [1] - upper right
 // [2] - bottom left
 // [3] - bottom right
-func Interpolate(w, h uint8, v [4]uint8) [][]uint8 {
+func Interpolate(w, h int, v [4]uint8) [][]uint8 {
+	return InterpolateWith(BilinearKernel{}, w, h, v)
+}
+
+// InterpolateWith returns the area of the given size filled by the kernel from the four given values. The order of the
+// values is the same as for Interpolate.
+func InterpolateWith(kernel Kernel, w, h int, v [4]uint8) [][]uint8 {
 	result := make([][]uint8, w)
-	for x := uint8(0); x < w; x++ {
+	for x := 0; x < w; x++ {
 		result[x] = make([]uint8, h)
 	}
 
+	kernel.Fill(result, w, h, v)
+	return result
+}
+
+// InterpolateMesh returns the interpolated area for corner values lying on the vertices of a mesh. In contrast to
+// Interpolate, the right and bottom corners lie one pixel beyond the area, where the next area starts. Therefore, the
+// upper right, bottom left and bottom right values are only reached in the neighboring areas, which share these
+// vertices. The order of the values is the same as for Interpolate.
+func InterpolateMesh(w, h int, v [4]uint8) [][]uint8 {
+	result := Interpolate(w+1, h+1, v)
+
+	result = result[:w]
+	for x := range result {
+		result[x] = result[x][:h]
+	}
+
+	return result
+}
+
+// Kernel fills an area from the values of its four corners. The order of the values is the same as for Interpolate.
+// Four equal values must result in an area of this value.
+type Kernel interface {
+	// Fill sets all values of dst, which has w columns of h values each, from the four corner values v.
+	Fill(dst [][]uint8, w, h int, v [4]uint8)
+}
+
+// BilinearKernel interpolates linearly between the corners, first along the upper and bottom row and then along each
+// column. The interpolated values are truncated to integers.
+type BilinearKernel struct{}
+
+func (k BilinearKernel) Fill(dst [][]uint8, w, h int, v [4]uint8) {
+	fill(dst, w, h, v, func(from, to float32, step, length int) uint8 {
+		increasePerStep := (to - from) / float32(length)
+		return uint8(from + float32(step)*increasePerStep)
+	})
+}
+
+// NearestCornerKernel gives each pixel the value of its nearest corner, which results in four blocks of constant
+// values. Pixels exactly in the middle get the value of the right or bottom corner.
+type NearestCornerKernel struct{}
+
+func (k NearestCornerKernel) Fill(dst [][]uint8, w, h int, v [4]uint8) {
+	fill(dst, w, h, v, func(from, to float32, step, length int) uint8 {
+		if 2*step < length {
+			return uint8(from)
+		}
+		return uint8(to)
+	})
+}
+
+// SmoothstepKernel interpolates like the BilinearKernel but eases in and out of the corners with the smoothstep
+// function 3t² - 2t³. The gradient vanishes at the edges of the area, so neighboring areas join without the visible
+// kinks of the bilinear interpolation.
+type SmoothstepKernel struct{}
+
+func (k SmoothstepKernel) Fill(dst [][]uint8, w, h int, v [4]uint8) {
+	fill(dst, w, h, v, func(from, to float32, step, length int) uint8 {
+		t := float32(step) / float32(length)
+		return uint8(from + (to-from)*t*t*(3-2*t))
+	})
+}
+
+// fill sets the corners of the area to the given values and then interpolates the first and last row and afterwards
+// all columns between them. The interpolation function returns the value at the given step of the given number of
+// steps between two values.
+func fill(dst [][]uint8, w, h int, v [4]uint8, interpolation func(from, to float32, step, length int) uint8) {
 	// Fill corner, which are already known by the four given values
-	result[0][0] = v[0]
-	result[w-1][0] = v[1]
-	result[0][h-1] = v[2]
-	result[w-1][h-1] = v[3]
+	dst[0][0] = v[0]
+	dst[w-1][0] = v[1]
+	dst[0][h-1] = v[2]
+	dst[w-1][h-1] = v[3]
 
 	// First, interpolate first and last row
-	interpolateRow(result, 0)
-	interpolateRow(result, h-1)
+	interpolateRow(dst, 0, interpolation)
+	interpolateRow(dst, h-1, interpolation)
 
 	// Then interpolate all columns between first and last row
-	for x := uint8(0); x < w; x++ {
-		interpolateColumn(result, x)
+	for x := 0; x < w; x++ {
+		interpolateColumn(dst, x, interpolation)
 	}
-
-	return result
 }
 
-func interpolateRow(v [][]uint8, y uint8) {
+func interpolateRow(v [][]uint8, y int, interpolation func(from, to float32, step, length int) uint8) {
 	w := len(v)
 	leftXValue := float32(v[0][y])
 	rightXValue := float32(v[w-1][y])
-	increasePerColumn := (rightXValue - leftXValue) / float32(w-1)
 	for x := 1; x < w-1; x++ {
-		v[x][y] = uint8(leftXValue + float32(x)*increasePerColumn)
+		v[x][y] = interpolation(leftXValue, rightXValue, x, w-1)
 	}
 }
 
-func interpolateColumn(v [][]uint8, x uint8) {
+func interpolateColumn(v [][]uint8, x int, interpolation func(from, to float32, step, length int) uint8) {
 	h := len(v[x])
 	upperYValue := float32(v[x][0])
 	lowerYValue := float32(v[x][h-1])
-	increasePerRow := (lowerYValue - upperYValue) / float32(h-1)
 	for y := 1; y < h-1; y++ {
-		v[x][y] = uint8(upperYValue + float32(y)*increasePerRow)
+		v[x][y] = interpolation(upperYValue, lowerYValue, y, h-1)
+	}
+}
+
+// Constant returns an area, whose pixels all have the given value.
+func Constant(w, h int, value uint8) [][]uint8 {
+	result := make([][]uint8, w)
+	for x := 0; x < w; x++ {
+		result[x] = make([]uint8, h)
+		for y := 0; y < h; y++ {
+			result[x][y] = value
+		}
+	}
+	return result
+}
+
+// InterpolateHorizontal returns the area filled by the kernel between the left and right value. All rows are equal,
+// the result is the same as for InterpolateWith and the values left, right, left and right.
+func InterpolateHorizontal(kernel Kernel, w, h int, left, right uint8) [][]uint8 {
+	row := InterpolateWith(kernel, w, 1, [4]uint8{left, right, left, right})
+
+	result := make([][]uint8, w)
+	for x := range result {
+		result[x] = make([]uint8, h)
+		for y := range result[x] {
+			result[x][y] = row[x][0]
+		}
+	}
+	return result
+}
+
+// InterpolateVertical returns the area filled by the kernel between the upper and bottom value. All columns are equal,
+// the result is the same as for InterpolateWith and the values upper, upper, bottom and bottom.
+func InterpolateVertical(kernel Kernel, w, h int, upper, bottom uint8) [][]uint8 {
+	column := InterpolateWith(kernel, 1, h, [4]uint8{upper, upper, bottom, bottom})
+
+	result := make([][]uint8, w)
+	for x := range result {
+		result[x] = make([]uint8, h)
+		copy(result[x], column[0])
+	}
+	return result
+}
+
+// InterpolateQuadratic returns the area of the biquadratic patch through the given 3x3 control values. The control
+// values are given row by row and lie on the corners, on the middle of the edges and on the center of the area:
+// [0] [1] [2] - upper row
+// [3] [4] [5] - middle row
+// [6] [7] [8] - bottom row
+// In contrast to the bilinear interpolation, the values are rounded and clamped to 0-255, since the patch can exceed
+// its control values.
+func InterpolateQuadratic(w, h int, v [9]uint8) [][]uint8 {
+	xWeights := quadraticWeights(w)
+	yWeights := quadraticWeights(h)
+
+	result := make([][]uint8, w)
+	for x := 0; x < w; x++ {
+		result[x] = make([]uint8, h)
+
+		// Values of the three rows at this column
+		var column [3]float64
+		for row := range column {
+			for i, weight := range xWeights[x] {
+				column[row] += weight * float64(v[3*row+i])
+			}
+		}
+
+		for y := 0; y < h; y++ {
+			value := 0.0
+			for row, weight := range yWeights[y] {
+				value += weight * column[row]
+			}
+			result[x][y] = uint8(math.Max(0, math.Min(255, math.Round(value))))
+		}
+	}
+
+	return result
+}
+
+// quadraticWeights returns the weights of the three control values for each of the given number of pixels. The weights
+// are the quadratic Lagrange polynomials through 0, 0.5 and 1, which are evaluated at the relative pixel position.
+func quadraticWeights(size int) [][3]float64 {
+	weights := make([][3]float64, size)
+	for i := range weights {
+		u := 0.0
+		if size > 1 {
+			u = float64(i) / float64(size-1)
+		}
+		weights[i] = [3]float64{2*u*u - 3*u + 1, 4*u - 4*u*u, 2*u*u - u}
 	}
+	return weights
 }
@@ -113,3 +113,132 @@ func TestInterpolation_singlePoint(t *testing.T) {
 
 	util.AssertArrayEqual(t, expected, actual)
 }
+
+func TestInterpolateMesh(t *testing.T) {
+	// 0 . . 9
+	// . . . .
+	// 6 . . 12
+	// The last row and column belong to the neighboring areas. Values are truncated.
+	// TransposeArray needed because the image data is actually stored column-wise, but we create it row-wise here.
+	expected := util.TransposeArray([][]uint8{
+		{0, 3, 6},
+		{3, 5, 8},
+	})
+
+	actual := InterpolateMesh(3, 2, [4]uint8{0, 9, 6, 12})
+
+	util.AssertArrayEqual(t, expected, actual)
+}
+
+func TestInterpolateMesh_singlePoint(t *testing.T) {
+	expected := [][]uint8{
+		{42},
+	}
+
+	actual := InterpolateMesh(1, 1, [4]uint8{42, 0, 0, 0})
+
+	util.AssertArrayEqual(t, expected, actual)
+}
+
+func TestNearestCornerKernel(t *testing.T) {
+	// 10 . .  20
+	//  . . .  .
+	// 30 . .  40
+	// Pixels in the middle of a column belong to the bottom corners.
+	// TransposeArray needed because the image data is actually stored column-wise, but we create it row-wise here.
+	expected := util.TransposeArray([][]uint8{
+		{10, 10, 20, 20},
+		{30, 30, 40, 40},
+		{30, 30, 40, 40},
+	})
+
+	actual := InterpolateWith(NearestCornerKernel{}, 4, 3, [4]uint8{10, 20, 30, 40})
+
+	util.AssertArrayEqual(t, expected, actual)
+}
+
+func TestSmoothstepKernel(t *testing.T) {
+	// 0 . . . 200
+	// The values ease in and out of the corners instead of increasing by 50 per pixel. Values are truncated.
+	// TransposeArray needed because the image data is actually stored column-wise, but we create it row-wise here.
+	expected := util.TransposeArray([][]uint8{
+		{0, 31, 100, 168, 200},
+	})
+
+	actual := InterpolateWith(SmoothstepKernel{}, 5, 1, [4]uint8{0, 200, 0, 200})
+
+	util.AssertArrayEqual(t, expected, actual)
+}
+
+func TestKernels_equalValues(t *testing.T) {
+	for _, kernel := range []Kernel{BilinearKernel{}, NearestCornerKernel{}, SmoothstepKernel{}} {
+		util.AssertArrayEqual(t, Constant(7, 5, 173), InterpolateWith(kernel, 7, 5, [4]uint8{173, 173, 173, 173}))
+	}
+}
+
+func TestConstant(t *testing.T) {
+	expected := [][]uint8{
+		{7, 7},
+		{7, 7},
+		{7, 7},
+	}
+
+	actual := Constant(3, 2, 7)
+
+	util.AssertArrayEqual(t, expected, actual)
+}
+
+func TestInterpolateHorizontal(t *testing.T) {
+	// Same as the bilinear interpolation with equal upper and bottom values
+	expected := Interpolate(5, 3, [4]uint8{200, 7, 200, 7})
+
+	actual := InterpolateHorizontal(BilinearKernel{}, 5, 3, 200, 7)
+
+	util.AssertArrayEqual(t, expected, actual)
+}
+
+func TestInterpolateVertical(t *testing.T) {
+	// Same as the bilinear interpolation with equal left and right values
+	expected := Interpolate(3, 5, [4]uint8{200, 200, 7, 7})
+
+	actual := InterpolateVertical(BilinearKernel{}, 3, 5, 200, 7)
+
+	util.AssertArrayEqual(t, expected, actual)
+}
+
+func TestInterpolateHorizontalAndVertical_smoothstep(t *testing.T) {
+	kernel := SmoothstepKernel{}
+
+	util.AssertArrayEqual(t, InterpolateWith(kernel, 6, 4, [4]uint8{3, 250, 3, 250}), InterpolateHorizontal(kernel, 6, 4, 3, 250))
+	util.AssertArrayEqual(t, InterpolateWith(kernel, 6, 4, [4]uint8{250, 250, 3, 3}), InterpolateVertical(kernel, 6, 4, 250, 3))
+}
+
+func TestInterpolateQuadratic(t *testing.T) {
+	// The patch passes through its control values, which lie on the corners, edge midpoints and center for odd sizes.
+	// Between them, the parabola 0, 100, 0 bulges beyond the linear interpolation.
+	// TransposeArray needed because the image data is actually stored column-wise, but we create it row-wise here.
+	expected := util.TransposeArray([][]uint8{
+		{0, 75, 100, 75, 0},
+		{5, 80, 105, 80, 5},
+		{10, 85, 110, 85, 10},
+	})
+
+	actual := InterpolateQuadratic(5, 3, [9]uint8{
+		0, 100, 0,
+		5, 105, 5,
+		10, 110, 10,
+	})
+
+	util.AssertArrayEqual(t, expected, actual)
+}
+
+func TestInterpolateQuadratic_clamped(t *testing.T) {
+	// The parabola through 0, 255, 255 exceeds 255 between the last two control values (at 287)
+	actual := InterpolateQuadratic(5, 1, [9]uint8{
+		0, 255, 255,
+		0, 0, 0,
+		0, 0, 0,
+	})
+
+	util.AssertArrayEqual(t, [][]uint8{{0}, {159}, {255}, {255}, {255}}, actual)
+}
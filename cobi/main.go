@@ -3,17 +3,34 @@ package main
 import (
 	"cobi/encoding"
 	"cobi/image"
+	"cobi/metrics"
 	"cobi/png"
+	"cobi/util"
+	"encoding/json"
+	"fmt"
 	"github.com/alecthomas/kong"
 	"github.com/hauke96/sigolo"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
 var cli struct {
-	Debug  bool   `help:"Enable debug mode." short:"d"`
-	Input  string `help:"The input file" short:"i" required:"true"`
-	Output string `help:"The output file" short:"o" optional:"true"`
+	Debug       bool   `help:"Enable debug mode." short:"d"`
+	Input       string `help:"The input file" short:"i" required:"true"`
+	Output      string `help:"The output file" short:"o" optional:"true"`
+	Quality     int    `help:"The quality of the compression from 0 to 100. Higher values result in better quality but larger files." short:"q" default:"${defaultQuality}"`
+	TargetSize  string `help:"The maximum size of the output file: A positive number, optionally with an exponent, followed by an optional unit B, KB, MB, GB, KiB, MiB or GiB (e.g. 50KB, 1.5MiB or 1e5). The highest quality fitting into this size is used, the quality flag is ignored." short:"t" optional:"true"`
+	Cost        string `help:"The cost function determining the error of an interpolated area: ${costFuncs}." default:"default" enum:"${costFuncs}"`
+	MaxError    int    `help:"Enable the near-lossless mode: No pixel deviates by more than this value from the original one. Negative values disable this mode." default:"-1"`
+	Lossless    bool   `help:"Enable the lossless mode: The differences to the original image are stored as well, so that the image can be restored exactly."`
+	Entropy     string `help:"The entropy coding of the areas in the output file: ${entropyCodings}." default:"range" enum:"${entropyCodings}"`
+	Partitioner string `help:"The strategy splitting the image into areas: ${partitioners}." default:"greedy" enum:"${partitioners}"`
+	Mesh        bool   `help:"Enable the mesh mode: Neighboring areas share the values of their common corners, which avoids seams between them."`
+	Interpolate string `help:"The kernel filling the areas from their corners, which trades blockiness against smoothness: ${interpolations}. Only bilinear can be used in mesh mode." default:"bilinear" enum:"${interpolations}"`
+	Workers     int    `help:"The number of channels or strips encoded concurrently. All CPUs are used when this is 0." default:"0"`
+	StripHeight int    `help:"Split the image into independently encoded horizontal strips of this height, which allows more concurrency. The whole image is one strip when this is 0." default:"0"`
+	MetricsJson bool   `help:"Print the quality metrics (MSE, PSNR and SSIM per channel) of the compressed image as JSON to stdout." name:"metrics-json"`
 }
 
 type Mode int
@@ -24,7 +41,13 @@ const (
 )
 
 func main() {
-	kong.Parse(&cli)
+	kong.Parse(&cli, kong.Vars{
+		"defaultQuality": strconv.Itoa(encoding.DefaultQuality),
+		"costFuncs":      strings.Join(encoding.CostFuncNames(), ","),
+		"entropyCodings": strings.Join(encoding.EntropyCodingNames(), ","),
+		"partitioners":   strings.Join(encoding.PartitionerNames(), ","),
+		"interpolations": strings.Join(encoding.InterpolationNames(), ","),
+	})
 
 	if cli.Debug {
 		sigolo.LogLevel = sigolo.LOG_DEBUG
@@ -60,43 +83,137 @@ func main() {
 			sigolo.Fatal("Unsupported file extension %s for compression", inputFileExt)
 		}
 
+		targetSize := 0
+		if cli.TargetSize != "" {
+			var err error
+			targetSize, err = util.ParseByteSize(cli.TargetSize)
+			sigolo.FatalCheck(err)
+		}
+
+		costFunc, err := encoding.GetCostFunc(cli.Cost)
+		sigolo.FatalCheck(err)
+		entropyCoding, err := encoding.GetEntropyCoding(cli.Entropy)
+		sigolo.FatalCheck(err)
+		partitioner, err := encoding.GetPartitioner(cli.Partitioner)
+		sigolo.FatalCheck(err)
+		interpolation, err := encoding.GetInterpolation(cli.Interpolate)
+		sigolo.FatalCheck(err)
+
+		options := &encoding.Options{
+			Quality:       cli.Quality,
+			CostFunc:      costFunc,
+			NearLossless:  cli.MaxError >= 0,
+			MaxPixelError: cli.MaxError,
+			Lossless:      cli.Lossless,
+			EntropyCoding: entropyCoding,
+			Mesh:          cli.Mesh,
+			Partitioner:   partitioner,
+			Workers:       cli.Workers,
+			StripHeight:   cli.StripHeight,
+			Interpolation: interpolation,
+		}
+
 		// Compress the image
-		encodedAreas, err := compress(cli.Input, reader)
+		originalImage, encodedImage, err := compress(cli.Input, reader, options, targetSize)
 		sigolo.FatalCheck(err)
-		err = encoding.Write(cli.Output, encodedAreas)
+		err = encoding.Write(cli.Output, encodedImage)
 		sigolo.FatalCheck(err)
 
-		if cli.Debug {
-			decodedImage, err := encoding.Decode(encodedAreas)
-			sigolo.FatalCheck(err)
+		// Determine how lossy the compression was
+		decodedImage, err := encoding.DecodeImage(encodedImage)
+		sigolo.FatalCheck(err)
+		err = printMetrics(originalImage, decodedImage, cli.MetricsJson)
+		sigolo.FatalCheck(err)
 
+		if cli.Debug {
 			pngWriter := png.Writer{}
 			err = pngWriter.Write(inputFileName+"_decoded.png", *decodedImage)
 			sigolo.FatalCheck(err)
-			err = pngWriter.Write(inputFileName+"_decoded_debug.png", *encoding.GetDebugImage(decodedImage.Width, decodedImage.Height, encodedAreas))
+			err = pngWriter.Write(inputFileName+"_decoded_debug.png", *encoding.GetDebugImage(decodedImage.Width, decodedImage.Height, encodedImage.Areas))
 			sigolo.FatalCheck(err)
 		}
 	case ModeDecompress:
-		sigolo.Fatal("Decompression is not implemented yet")
+		// Determine correct writer for the output image
+		var writer *png.Writer
+		switch outputFileExt := filepath.Ext(cli.Output); outputFileExt {
+		case ".png":
+			writer = &png.Writer{}
+		default:
+			sigolo.Fatal("Unsupported file extension %s for decompression", outputFileExt)
+		}
+
+		// Decompress the image
+		decodedImage, err := decompress(cli.Input)
+		sigolo.FatalCheck(err)
+		err = writer.Write(cli.Output, *decodedImage)
+		sigolo.FatalCheck(err)
 	default:
 		sigolo.Fatal("Invalid compression mode %d", mode)
 	}
 }
 
-func compress(filePath string, reader image.Reader) ([4][]encoding.EncodedArea, error) {
+// compress encodes the given image file. When a target size is given (i.e. it's larger than 0), the quality of the
+// options is ignored and the highest quality, that doesn't exceed the target size, is used.
+func compress(filePath string, reader image.Reader, options *encoding.Options, targetSize int) (*image.Image, *encoding.EncodedImage, error) {
 	img, err := reader.Read(filePath)
 	if err != nil {
-		return [4][]encoding.EncodedArea{}, err
+		return nil, nil, err
 	}
 
 	//if sigolo.LogLevel == sigolo.LOG_DEBUG {
 	//	img.Print()
 	//}
 
-	encodedAreas, err := encoding.Encode(*img)
+	if targetSize > 0 {
+		encodedImage, quality, err := encoding.EncodeImageWithTargetSize(*img, targetSize, options)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sigolo.Info("Use quality %d to reach target size of %d bytes", quality, targetSize)
+		return img, encodedImage, nil
+	}
+
+	encodedImage, err := encoding.EncodeImage(*img, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return img, encodedImage, nil
+}
+
+// printMetrics logs the quality metrics of the decoded image compared to the original one. With the JSON flag set, the
+// metrics are printed as JSON to stdout instead.
+func printMetrics(originalImage, decodedImage *image.Image, printJson bool) error {
+	m, err := metrics.Compare(originalImage, decodedImage)
+	if err != nil {
+		return err
+	}
+
+	if printJson {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	for _, channel := range []struct {
+		name    string
+		metrics metrics.ChannelMetrics
+	}{{"R", m.R}, {"G", m.G}, {"B", m.B}, {"A", m.A}} {
+		sigolo.Info("Channel %s: MSE=%.3f PSNR=%.2fdB SSIM=%.4f", channel.name, channel.metrics.MSE, channel.metrics.PSNR, channel.metrics.SSIM)
+	}
+
+	return nil
+}
+
+func decompress(filePath string) (*image.Image, error) {
+	encodedImage, err := encoding.Read(filePath)
 	if err != nil {
-		return [4][]encoding.EncodedArea{}, err
+		return nil, err
 	}
 
-	return encodedAreas, nil
+	return encoding.DecodeImage(encodedImage)
 }
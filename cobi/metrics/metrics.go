@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"cobi/image"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+)
+
+// ssimWindowSize is the edge length of the square windows SSIM is computed on.
+const ssimWindowSize = 8
+
+// ssimWindowStep is the distance between two neighboring SSIM windows.
+const ssimWindowStep = 4
+
+// Constants to stabilize the SSIM division with weak denominators, as proposed by Wang et al. for 8-bit data.
+const (
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// ChannelMetrics contains the quality metrics of one color channel.
+type ChannelMetrics struct {
+	// MSE is the mean squared error between the original and the decoded values.
+	MSE float64
+	// PSNR is the peak signal-to-noise ratio in dB. It's infinite when both channels are equal.
+	PSNR float64
+	// SSIM is the mean structural similarity index between -1 and 1, where 1 means both channels are equal.
+	SSIM float64
+}
+
+// Metrics contains the quality metrics of the color channels R, G, B and A.
+type Metrics struct {
+	R ChannelMetrics `json:"r"`
+	G ChannelMetrics `json:"g"`
+	B ChannelMetrics `json:"b"`
+	A ChannelMetrics `json:"a"`
+}
+
+// Compare computes the quality metrics of the decoded image compared to the original one. Both images must have the
+// same size.
+func Compare(original, decoded *image.Image) (*Metrics, error) {
+	if original.Width != decoded.Width || original.Height != decoded.Height {
+		return nil, errors.New(fmt.Sprintf("Images must have the same size but have %dx%d and %dx%d", original.Width, original.Height, decoded.Width, decoded.Height))
+	}
+
+	return &Metrics{
+		R: compareChannel(original.R, decoded.R),
+		G: compareChannel(original.G, decoded.G),
+		B: compareChannel(original.B, decoded.B),
+		A: compareChannel(original.A, decoded.A),
+	}, nil
+}
+
+func compareChannel(original, decoded [][]uint8) ChannelMetrics {
+	mse := MSE(original, decoded)
+	return ChannelMetrics{
+		MSE:  mse,
+		PSNR: PSNR(mse),
+		SSIM: SSIM(original, decoded),
+	}
+}
+
+// MSE returns the mean squared error of the two channels, which must have the same size.
+func MSE(a, b [][]uint8) float64 {
+	summedSquaredErrors := 0.0
+	numberOfPixels := 0
+	for x := range a {
+		for y := range a[x] {
+			diff := float64(a[x][y]) - float64(b[x][y])
+			summedSquaredErrors += diff * diff
+			numberOfPixels++
+		}
+	}
+
+	if numberOfPixels == 0 {
+		return 0
+	}
+	return summedSquaredErrors / float64(numberOfPixels)
+}
+
+// PSNR returns the peak signal-to-noise ratio in dB for the given mean squared error of 8-bit values. For an error of 0
+// the result is positive infinity.
+func PSNR(mse float64) float64 {
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+// SSIM returns the mean structural similarity index of the two channels, which must have the same size. The index is
+// computed on square windows of ssimWindowSize pixels, which are ssimWindowStep pixels apart. Additional windows are
+// aligned to the right and bottom edge, when the steps don't reach them, so that every pixel is covered. Channels
+// smaller than one window are treated as one window.
+func SSIM(a, b [][]uint8) float64 {
+	width := len(a)
+	if width == 0 || len(a[0]) == 0 {
+		return 1
+	}
+	height := len(a[0])
+
+	windowWidth := int(math.Min(ssimWindowSize, float64(width)))
+	windowHeight := int(math.Min(ssimWindowSize, float64(height)))
+
+	summedSsim := 0.0
+	numberOfWindows := 0
+	for _, x := range windowPositions(width, windowWidth) {
+		for _, y := range windowPositions(height, windowHeight) {
+			summedSsim += ssimOfWindow(a, b, x, y, windowWidth, windowHeight)
+			numberOfWindows++
+		}
+	}
+
+	return summedSsim / float64(numberOfWindows)
+}
+
+// windowPositions returns the start positions of the windows of the given size along one axis of the channel. The
+// windows are ssimWindowStep pixels apart and the last one ends at the edge of the channel.
+func windowPositions(size, windowSize int) []int {
+	var positions []int
+	for position := 0; position+windowSize <= size; position += ssimWindowStep {
+		positions = append(positions, position)
+	}
+	if positions[len(positions)-1]+windowSize < size {
+		positions = append(positions, size-windowSize)
+	}
+	return positions
+}
+
+func ssimOfWindow(a, b [][]uint8, x1, y1, width, height int) float64 {
+	numberOfPixels := float64(width * height)
+
+	meanA, meanB := 0.0, 0.0
+	for x := x1; x < x1+width; x++ {
+		for y := y1; y < y1+height; y++ {
+			meanA += float64(a[x][y])
+			meanB += float64(b[x][y])
+		}
+	}
+	meanA /= numberOfPixels
+	meanB /= numberOfPixels
+
+	varianceA, varianceB, covariance := 0.0, 0.0, 0.0
+	for x := x1; x < x1+width; x++ {
+		for y := y1; y < y1+height; y++ {
+			diffA := float64(a[x][y]) - meanA
+			diffB := float64(b[x][y]) - meanB
+			varianceA += diffA * diffA
+			varianceB += diffB * diffB
+			covariance += diffA * diffB
+		}
+	}
+	varianceA /= numberOfPixels
+	varianceB /= numberOfPixels
+	covariance /= numberOfPixels
+
+	return ((2*meanA*meanB + ssimC1) * (2*covariance + ssimC2)) /
+		((meanA*meanA + meanB*meanB + ssimC1) * (varianceA + varianceB + ssimC2))
+}
+
+// MarshalJSON writes the metrics with lower-case keys. An infinite PSNR is written as null, since JSON has no
+// representation for infinity.
+func (m ChannelMetrics) MarshalJSON() ([]byte, error) {
+	var psnr *float64
+	if !math.IsInf(m.PSNR, 0) {
+		psnr = &m.PSNR
+	}
+
+	return json.Marshal(struct {
+		MSE  float64  `json:"mse"`
+		PSNR *float64 `json:"psnr"`
+		SSIM float64  `json:"ssim"`
+	}{
+		MSE:  m.MSE,
+		PSNR: psnr,
+		SSIM: m.SSIM,
+	})
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"cobi/image"
+	"cobi/util"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func Test_mse(t *testing.T) {
+	a := [][]uint8{{0, 10}, {20, 30}}
+	b := [][]uint8{{2, 8}, {20, 34}}
+
+	util.AssertEqual(t, 6.0, MSE(a, b))
+	util.AssertEqual(t, 0.0, MSE(a, a))
+}
+
+func Test_psnr(t *testing.T) {
+	util.AssertTrue(t, math.IsInf(PSNR(0), 1))
+	util.AssertTrue(t, math.Abs(PSNR(1)-48.1308) < 0.0001)
+	util.AssertTrue(t, PSNR(10) < PSNR(1))
+}
+
+func Test_ssim(t *testing.T) {
+	a := newGradientChannel(20, 12, 0)
+	b := newGradientChannel(20, 12, 0)
+	b[5][5] = 255
+
+	util.AssertTrue(t, math.Abs(SSIM(a, a)-1) < 1e-9)
+	util.AssertTrue(t, SSIM(a, b) < 1)
+	util.AssertTrue(t, SSIM(a, b) > 0)
+}
+
+func Test_ssim_edges(t *testing.T) {
+	// The steps of the windows don't reach the last column and row
+	a := newGradientChannel(13, 11, 0)
+	right := newGradientChannel(13, 11, 0)
+	right[12][5] = 255
+	bottom := newGradientChannel(13, 11, 0)
+	bottom[5][10] = 255
+
+	util.AssertDeepEqual(t, []int{0, 4, 5}, windowPositions(13, 8))
+	util.AssertDeepEqual(t, []int{0, 4}, windowPositions(12, 8))
+	util.AssertTrue(t, SSIM(a, right) < 1)
+	util.AssertTrue(t, SSIM(a, bottom) < 1)
+}
+
+func Test_ssim_smallChannel(t *testing.T) {
+	a := newGradientChannel(3, 2, 0)
+
+	util.AssertTrue(t, math.Abs(SSIM(a, a)-1) < 1e-9)
+}
+
+func Test_compare(t *testing.T) {
+	original := newImage(10, 10, 0)
+	decoded := newImage(10, 10, 2)
+
+	m, err := Compare(original, decoded)
+
+	util.AssertNil(t, err)
+	util.AssertEqual(t, 4.0, m.R.MSE)
+	util.AssertEqual(t, 4.0, m.G.MSE)
+	util.AssertEqual(t, 4.0, m.B.MSE)
+	util.AssertEqual(t, 4.0, m.A.MSE)
+	util.AssertEqual(t, PSNR(4), m.R.PSNR)
+}
+
+func Test_compare_differentSizes(t *testing.T) {
+	_, err := Compare(newImage(10, 10, 0), newImage(10, 9, 0))
+
+	util.AssertError(t, "Images must have the same size but have 10x10 and 10x9", err)
+}
+
+func Test_metrics_json(t *testing.T) {
+	m := Metrics{
+		R: ChannelMetrics{MSE: 0, PSNR: math.Inf(1), SSIM: 1},
+		G: ChannelMetrics{MSE: 1, PSNR: 48, SSIM: 0.5},
+	}
+
+	data, err := json.Marshal(m)
+
+	util.AssertNil(t, err)
+	util.AssertEqual(t, `{"r":{"mse":0,"psnr":null,"ssim":1},"g":{"mse":1,"psnr":48,"ssim":0.5},"b":{"mse":0,"psnr":0,"ssim":0},"a":{"mse":0,"psnr":0,"ssim":0}}`, string(data))
+}
+
+func newGradientChannel(width, height int, offset uint8) [][]uint8 {
+	channel := make([][]uint8, width)
+	for x := range channel {
+		channel[x] = make([]uint8, height)
+		for y := range channel[x] {
+			channel[x][y] = uint8(x*10+y) + offset
+		}
+	}
+	return channel
+}
+
+func newImage(width, height int, offset uint8) *image.Image {
+	img := image.New(width, height)
+	img.R = newGradientChannel(width, height, offset)
+	img.G = newGradientChannel(width, height, offset)
+	img.B = newGradientChannel(width, height, offset)
+	img.A = newGradientChannel(width, height, offset)
+	return img
+}
@@ -15,6 +15,7 @@ func (w *Writer) Write(filePath string, img image.Image) error {
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Could not open output image %s", filePath))
 	}
+	defer file.Close()
 
 	err = png.Encode(file, &img)
 	if err != nil {
@@ -3,6 +3,7 @@ package util
 import (
 	"fmt"
 	"github.com/hauke96/sigolo"
+	"math"
 	"reflect"
 	"testing"
 )
@@ -56,6 +57,20 @@ func AssertEqual[T comparable](t *testing.T, expected T, actual T) {
 	}
 }
 
+func AssertDeepEqual(t *testing.T, expected interface{}, actual interface{}) {
+	if !reflect.DeepEqual(expected, actual) {
+		sigolo.Errorb(1, "Expected %v but found %v", expected, actual)
+		t.Fail()
+	}
+}
+
+func AssertAlmostEqual(t *testing.T, expected float64, actual float64, delta float64) {
+	if math.Abs(expected-actual) > delta {
+		sigolo.Errorb(1, "Expected %v (+/- %v) but found %v", expected, delta, actual)
+		t.Fail()
+	}
+}
+
 func AssertArrayEqual[T comparable](t *testing.T, expected [][]T, actual [][]T) {
 	if len(expected) != len(actual) {
 		sigolo.Errorb(1, "Arrays must have the same size in the first dimension, but %d != %d", len(expected), len(actual))
@@ -71,7 +86,7 @@ func AssertArrayEqual[T comparable](t *testing.T, expected [][]T, actual [][]T)
 		}
 		for y := 0; y < len(expected[x]); y++ {
 			if expected[x][y] != actual[x][y] {
-				sigolo.Errorb(1, "Arrays are unequal at [%d, %d]: %d != %d", x, y, len(expected[x]), len(actual[x]))
+				sigolo.Errorb(1, "Arrays are unequal at [%d, %d]: %v != %v", x, y, expected[x][y], actual[x][y])
 				assertArrayEqualFail(t, expected, actual)
 				return
 			}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// byteSizeNumber matches the number at the beginning of a size, which may have a fraction and an exponent.
+var byteSizeNumber = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?`)
+
+var byteSizeUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"KIB": 1024,
+	"MIB": 1024 * 1024,
+	"GIB": 1024 * 1024 * 1024,
+}
+
+// ParseByteSize parses sizes like "512", "1e3", "50KB", "1.5 MB" or "64KiB" into a number of bytes. A size is a decimal
+// number, optionally with an exponent, followed by an optional unit. The units KB, MB and GB are decimal
+// (1KB = 1000 bytes), the units KiB, MiB and GiB are binary (1KiB = 1024 bytes). Units are case-insensitive. Sizes of
+// less than one byte are invalid.
+func ParseByteSize(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	unitIndex := len(byteSizeNumber.FindString(s))
+
+	number, err := strconv.ParseFloat(s[:unitIndex], 64)
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("Invalid number in size %q", s))
+	}
+	if number < 0 {
+		return 0, errors.New(fmt.Sprintf("Size %q must not be negative", s))
+	}
+
+	unit := strings.TrimSpace(s[unitIndex:])
+	factor, ok := byteSizeUnits[strings.ToUpper(unit)]
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("Unknown unit %q in size %q", unit, s))
+	}
+
+	size := int(number * factor)
+	if size < 1 {
+		return 0, errors.New(fmt.Sprintf("Size %q must be at least one byte", s))
+	}
+	return size, nil
+}
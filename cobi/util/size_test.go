@@ -0,0 +1,45 @@
+package util
+
+import "testing"
+
+func Test_parseByteSize(t *testing.T) {
+	testCases := map[string]int{
+		"512":    512,
+		"512B":   512,
+		"50KB":   50000,
+		"50kb":   50000,
+		"1.5 MB": 1500000,
+		"64KiB":  65536,
+		"2MiB":   2097152,
+		" 1GB ":  1000000000,
+		"1e3":    1000,
+		"2.5E2B": 250,
+		"1e-3KB": 1,
+	}
+
+	for input, expected := range testCases {
+		actual, err := ParseByteSize(input)
+		AssertNil(t, err)
+		AssertEqual(t, expected, actual)
+	}
+}
+
+func Test_parseByteSize_invalidInput(t *testing.T) {
+	_, err := ParseByteSize("50XB")
+	AssertError(t, "Unknown unit \"XB\" in size \"50XB\"", err)
+
+	_, err = ParseByteSize("-5KB")
+	AssertError(t, "Size \"-5KB\" must not be negative", err)
+
+	_, err = ParseByteSize("KB")
+	AssertNotNil(t, err)
+
+	_, err = ParseByteSize("0")
+	AssertError(t, "Size \"0\" must be at least one byte", err)
+
+	_, err = ParseByteSize("0.5B")
+	AssertError(t, "Size \"0.5B\" must be at least one byte", err)
+
+	_, err = ParseByteSize("1e")
+	AssertError(t, "Unknown unit \"e\" in size \"1e\"", err)
+}
@@ -6,7 +6,7 @@ func PrintArray[T any](v [][]T) {
 	for y := 0; y < len(v[0]); y++ {
 		fmt.Print("[")
 		for x := 0; x < len(v); x++ {
-			fmt.Printf("%3d ", v[x][y])
+			fmt.Printf("%3v ", v[x][y])
 		}
 		fmt.Print("]\n")
 	}